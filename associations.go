@@ -0,0 +1,113 @@
+package copilot
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// AssociationStore is a local projection of which things are associated to which users. When one is configured
+// with WithAssociationStore, it is kept up to date as association events are sent, so that workflows such as
+// EraseUser know every thing a user has. Implement it to keep the projection in a database.
+type AssociationStore interface {
+	Associate(thingID string, userID string) error
+	Disassociate(thingID string, userID string) error
+	// ThingsForUser returns the IDs of the things associated to the user, sorted
+	ThingsForUser(userID string) ([]string, error)
+	// UsersForThing returns the IDs of the users associated to the thing, sorted
+	UsersForThing(thingID string) ([]string, error)
+}
+
+// WithAssociationStore records every association and disassociation that is sent in the store
+func WithAssociationStore(store AssociationStore) Option {
+	return func(config *configStruct) {
+		config.Associations = store
+	}
+}
+
+// MemoryAssociationStore is an in-memory AssociationStore
+type MemoryAssociationStore struct {
+	lock   sync.RWMutex
+	things map[string]map[string]bool
+	users  map[string]map[string]bool
+}
+
+// NewMemoryAssociationStore creates an empty in-memory association store
+func NewMemoryAssociationStore() *MemoryAssociationStore {
+	return &MemoryAssociationStore{
+		things: map[string]map[string]bool{},
+		users:  map[string]map[string]bool{},
+	}
+}
+
+// Associate records that the thing is associated to the user
+func (store *MemoryAssociationStore) Associate(thingID string, userID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.things[userID] == nil {
+		store.things[userID] = map[string]bool{}
+	}
+	if store.users[thingID] == nil {
+		store.users[thingID] = map[string]bool{}
+	}
+	store.things[userID][thingID] = true
+	store.users[thingID][userID] = true
+	return nil
+}
+
+// Disassociate removes the association between the thing and the user, if there is one
+func (store *MemoryAssociationStore) Disassociate(thingID string, userID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.things[userID], thingID)
+	if len(store.things[userID]) == 0 {
+		delete(store.things, userID)
+	}
+	delete(store.users[thingID], userID)
+	if len(store.users[thingID]) == 0 {
+		delete(store.users, thingID)
+	}
+	return nil
+}
+
+// ThingsForUser returns the IDs of the things associated to the user, sorted
+func (store *MemoryAssociationStore) ThingsForUser(userID string) ([]string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return sortedKeys(store.things[userID]), nil
+}
+
+// UsersForThing returns the IDs of the users associated to the thing, sorted
+func (store *MemoryAssociationStore) UsersForThing(thingID string) ([]string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return sortedKeys(store.users[thingID]), nil
+}
+
+// sortedKeys returns the keys of the set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// recordAssociation updates the association store, if there is one, after an association event was sent
+func (client *Client) recordAssociation(thingID string, userID string, associated bool) error {
+	config := client.configuration()
+	if config == nil || config.Associations == nil {
+		return nil
+	}
+	var err error
+	if associated {
+		err = config.Associations.Associate(thingID, userID)
+	} else {
+		err = config.Associations.Disassociate(thingID, userID)
+	}
+	if err != nil {
+		return fmt.Errorf("the event was sent but the association store could not be updated: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package copilot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// below are the defaults used by BulkUpdateConsent
+const (
+	defaultBulkConsentConcurrency = 8
+	defaultBulkConsentAttempts    = 3
+	defaultBulkConsentBackoff     = 500 * time.Millisecond
+)
+
+// ConsentUpdate is a single user's consent to update in bulk
+type ConsentUpdate struct {
+	UserID       string `json:"user_id"`
+	ConsentValue bool   `json:"consent_value"`
+}
+
+// ConsentResult is the outcome of a single update, written as a line of the report
+type ConsentResult struct {
+	UserID       string `json:"user_id"`
+	ConsentValue bool   `json:"consent_value"`
+	Succeeded    bool   `json:"succeeded"`
+	Attempts     int    `json:"attempts"`
+	Error        string `json:"error,omitempty"`
+	// CompletedAt is the Unix timestamp in milliseconds of the last attempt
+	CompletedAt int64 `json:"completed_at"`
+}
+
+// ConsentReport is the latest result for each user from a previous run, used to resume it
+type ConsentReport map[string]ConsentResult
+
+// BulkConsentSummary counts the outcomes of a bulk update
+type BulkConsentSummary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Skipped is the number of updates that already succeeded in the resumed report
+	Skipped int `json:"skipped"`
+}
+
+// BulkConsentOptions configures BulkUpdateConsent
+type BulkConsentOptions struct {
+	// Concurrency is the number of updates in flight at once; it defaults to 8
+	Concurrency int
+	// RatePerSecond limits how many requests are started per second, including retries; 0 is unlimited
+	RatePerSecond float64
+	// MaxAttempts is the number of times each update is tried; it defaults to 3. Only updates that could not be
+	// sent, or that Copilot answered with a 429 or 5xx, are tried again.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, which doubles on each retry; it defaults to 500 milliseconds
+	Backoff time.Duration
+	// Report, if set, receives each result as a line of JSON
+	Report io.Writer
+	// Resume skips updates that already succeeded with the same value in a previous report
+	Resume ConsentReport
+	// Client sends the updates; if nil, the default client is used
+	Client *Client
+}
+
+// ReadConsentReport reads a report written by BulkUpdateConsent, keeping the latest result for each user
+func ReadConsentReport(r io.Reader) (ConsentReport, error) {
+	report := ConsentReport{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		result := ConsentResult{}
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("consent report line %d could not be read: %w", line, err)
+		}
+		report[result.UserID] = result
+	}
+	return report, scanner.Err()
+}
+
+// BulkUpdateConsent calls UpdateUserConsent for every update received until the channel is closed, with bounded
+// concurrency, rate limiting and retries. Each result is written to the report. If the context is canceled,
+// updates in flight finish and the context's error is returned; the report can then be used to resume.
+func BulkUpdateConsent(ctx context.Context, updates <-chan ConsentUpdate, options BulkConsentOptions) (BulkConsentSummary, error) {
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultBulkConsentConcurrency
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultBulkConsentAttempts
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = defaultBulkConsentBackoff
+	}
+
+	var limiter <-chan time.Time
+	if options.RatePerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / options.RatePerSecond))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	summary := BulkConsentSummary{}
+	var reportErr error
+	results := make(chan ConsentResult)
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		var encoder *json.Encoder
+		if options.Report != nil {
+			encoder = json.NewEncoder(options.Report)
+		}
+		for result := range results {
+			if result.Succeeded {
+				summary.Succeeded++
+			} else {
+				summary.Failed++
+			}
+			if encoder != nil && reportErr == nil {
+				reportErr = encoder.Encode(result)
+			}
+		}
+	}()
+
+	work := make(chan ConsentUpdate)
+	wg := sync.WaitGroup{}
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for update := range work {
+				results <- updateConsentWithRetries(ctx, update, limiter, options)
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case update, ok := <-updates:
+			if !ok {
+				break feed
+			}
+			if previous, found := options.Resume[update.UserID]; found && previous.Succeeded && previous.ConsentValue == update.ConsentValue {
+				summary.Skipped++
+				continue
+			}
+			select {
+			case work <- update:
+			case <-ctx.Done():
+				err = ctx.Err()
+				break feed
+			}
+		}
+	}
+	close(work)
+	wg.Wait()
+	close(results)
+	<-reported
+
+	if err == nil {
+		err = reportErr
+	}
+	return summary, err
+}
+
+// updateConsentWithRetries sends a single update, retrying errors that may succeed with backoff
+func updateConsentWithRetries(ctx context.Context, update ConsentUpdate, limiter <-chan time.Time, options BulkConsentOptions) ConsentResult {
+	result := ConsentResult{
+		UserID:       update.UserID,
+		ConsentValue: update.ConsentValue,
+	}
+	backoff := options.Backoff
+	var err error
+	for result.Attempts < options.MaxAttempts {
+		if result.Attempts > 0 {
+			if !sleepContext(ctx, backoff) {
+				break
+			}
+			backoff *= 2
+		}
+		if limiter != nil {
+			select {
+			case <-limiter:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
+			}
+			break
+		}
+		result.Attempts++
+		err = options.Client.UpdateUserConsent(update.UserID, update.ConsentValue)
+		if err == nil || !retryableConsentError(err) {
+			break
+		}
+	}
+	result.Succeeded = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.CompletedAt = options.Client.now().UnixMilli()
+	return result
+}
+
+// retryableConsentError returns true if the update could not be sent or Copilot answered with a 429 or 5xx,
+// since any other response, such as a 400 for an invalid user, would be the same when tried again
+func retryableConsentError(err error) bool {
+	if errors.Is(err, ErrClientClosed) {
+		return false
+	}
+	var endpointErr *EndpointError
+	if !errors.As(err, &endpointErr) {
+		return true
+	}
+	status := endpointErr.StatusCode
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// sleepContext waits for the duration, returning false if the context is done first
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
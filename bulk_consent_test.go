@@ -0,0 +1,120 @@
+package copilot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func consentUpdates(count int) <-chan copilot.ConsentUpdate {
+	updates := make(chan copilot.ConsentUpdate)
+	go func() {
+		defer close(updates)
+		for i := 0; i < count; i++ {
+			updates <- copilot.ConsentUpdate{UserID: fmt.Sprintf("user-%d", i), ConsentValue: i%2 == 0}
+		}
+	}()
+	return updates
+}
+
+func TestBulkUpdateConsent(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	// with one worker, both attempts for the first user fail
+	recorder.FailOn(copilottest.ConsentEventType, errors.New("copilot is down"), 2)
+	report := &bytes.Buffer{}
+	summary, err := copilot.BulkUpdateConsent(context.Background(), consentUpdates(20), copilot.BulkConsentOptions{
+		Concurrency:   1,
+		RatePerSecond: 1000,
+		MaxAttempts:   2,
+		Backoff:       time.Millisecond,
+		Report:        report,
+		Client:        recorder.Client,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, copilot.BulkConsentSummary{Succeeded: 19, Failed: 1}, summary)
+	recorder.AssertConsent(t, "user-4", true)
+	recorder.AssertConsent(t, "user-5", false)
+
+	results, err := copilot.ReadConsentReport(bytes.NewReader(report.Bytes()))
+	assert.Nil(t, err)
+	assert.Len(t, results, 20)
+	assert.False(t, results["user-0"].Succeeded)
+	assert.Equal(t, 2, results["user-0"].Attempts)
+	assert.Equal(t, "copilot is down", results["user-0"].Error)
+
+	// resuming only sends the updates that have not succeeded
+	recorder.FailOn(copilottest.ConsentEventType, errors.New("copilot is down"), -1)
+	summary, err = copilot.BulkUpdateConsent(context.Background(), consentUpdates(20), copilot.BulkConsentOptions{
+		Concurrency: 4,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Report:      report,
+		Resume:      results,
+		Client:      recorder.Client,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, copilot.BulkConsentSummary{Failed: 1, Skipped: 19}, summary)
+	results, err = copilot.ReadConsentReport(bytes.NewReader(report.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, results["user-0"].Attempts)
+
+	recorder.ClearFailures()
+	summary, err = copilot.BulkUpdateConsent(context.Background(), consentUpdates(20), copilot.BulkConsentOptions{
+		Resume: results,
+		Client: recorder.Client,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, copilot.BulkConsentSummary{Succeeded: 1, Skipped: 19}, summary)
+	recorder.AssertConsent(t, "user-0", true)
+
+	// canceling stops the run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = copilot.BulkUpdateConsent(ctx, consentUpdates(20), copilot.BulkConsentOptions{Client: recorder.Client})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestBulkUpdateConsentRetries(t *testing.T) {
+	// user-0 is invalid, and user-1 is rate limited on its first attempt
+	var limited int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := copilot.ConsentRequest{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		switch {
+		case request.UserID == "user-0":
+			w.WriteHeader(http.StatusBadRequest)
+		case request.UserID == "user-1" && atomic.AddInt32(&limited, 1) == 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+	client, err := copilot.NewClient("id", "secret", server.URL, server.URL)
+	assert.Nil(t, err)
+
+	report := &bytes.Buffer{}
+	summary, err := copilot.BulkUpdateConsent(context.Background(), consentUpdates(3), copilot.BulkConsentOptions{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Report:      report,
+		Client:      client,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, copilot.BulkConsentSummary{Succeeded: 2, Failed: 1}, summary)
+	results, err := copilot.ReadConsentReport(bytes.NewReader(report.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, results["user-0"].Attempts)
+	assert.False(t, results["user-0"].Succeeded)
+	assert.Equal(t, 2, results["user-1"].Attempts)
+	assert.Equal(t, 1, results["user-2"].Attempts)
+}
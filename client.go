@@ -0,0 +1,62 @@
+package copilot
+
+import (
+	"time"
+)
+
+// Client sends events to Copilot using its own configuration. The package level functions, such as
+// UserCreated, use the default client, which is configured by Setup. A Client is needed when more than one
+// configuration is used in the same process, or when code should depend on the Emitter interface.
+type Client struct {
+	config *configStruct
+	// immediate sends events directly even when background sending is enabled
+	immediate bool
+}
+
+// NewClient creates a client with its own configuration. The credentials and collect endpoint are required
+// unless the client is in dry run mode, and the credentials can be blank when a CredentialProvider is used.
+func NewClient(clientID string, clientSecret string, collectEndpoint, consentEndpoint string, options ...Option) (*Client, error) {
+	config, err := newConfig(clientID, clientSecret, collectEndpoint, consentEndpoint, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		config: config,
+	}, nil
+}
+
+// DefaultClient returns the client used by the package level functions. It always uses the configuration
+// from the most recent successful call to Setup.
+func DefaultClient() *Client {
+	return &Client{}
+}
+
+// configuration returns the configuration the client uses, which is nil if it has not been configured
+func (client *Client) configuration() *configStruct {
+	if client == nil || client.config == nil {
+		return config
+	}
+	return client.config
+}
+
+// immediately returns a client with the same configuration that delivers each event before returning, for
+// workflows that must know an event was accepted before taking the next step
+func (client *Client) immediately() *Client {
+	immediate := &Client{
+		immediate: true,
+	}
+	if client != nil {
+		immediate.config = client.config
+	}
+	return immediate
+}
+
+// now returns the current time from the client's clock
+func (client *Client) now() time.Time {
+	return client.configuration().now()
+}
+
+// resolveTimestamp defaults and checks the timestamp using the client's configuration
+func (client *Client) resolveTimestamp(timestamp int64) (int64, error) {
+	return client.configuration().resolveTimestamp(timestamp)
+}
@@ -5,83 +5,154 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"time"
 )
 
-var httpClient = http.Client{Timeout: 5 * time.Second}
-
-func makeCollectAPICall(data eventRequest) (*EventResponse, *EventResponseError, error) {
+func makeCollectAPICall(config *configStruct, data eventRequest) (*EventResponse, *EventResponseError, error) {
 	if config == nil {
 		return nil, nil, errors.New("copilot client not configured")
 	}
+	if config.DryRun != nil {
+		response, err := dryRunCollect(config, data)
+		return response, nil, err
+	}
 	postBody, err := json.Marshal(data)
 	if err != nil {
 		return nil, nil, err
 	}
-	httpBody := bytes.NewBuffer(postBody)
-
-	req, err := http.NewRequest(http.MethodPost, config.CollectEndpoint, httpBody)
-	if err != nil {
+	// fail before any endpoint is tried, since missing credentials are not an endpoint failure
+	if _, err := config.CredentialProvider.Credentials(); err != nil {
 		return nil, nil, err
 	}
-	req.SetBasicAuth(config.ClientID, config.ClientSecret)
-	req.Header.Add("content-type", "application/json")
 
-	// now make the call
-	response, err := httpClient.Do(req)
+	var eventResponse *EventResponse
+	var errorResponse *EventResponseError
+	err = config.collectPool.call(config, func(endpoint string) (int, error) {
+		response, err := postJSON(config, config.collectHTTP, endpoint, postBody)
+		if err != nil {
+			return 0, err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			// parse the error message and return
+			errorResponse = &EventResponseError{
+				Endpoint: endpoint,
+			}
+			if err := json.NewDecoder(response.Body).Decode(errorResponse); err != nil {
+				return response.StatusCode, err
+			}
+			return response.StatusCode, errorResponse
+		}
+		// Copilot returns a 200 even if there are invalid events, so we need
+		// to determine if there are any invalid events and then return them
+		errorResponse = nil
+		eventResponse = &EventResponse{
+			Endpoint: endpoint,
+		}
+		return response.StatusCode, json.NewDecoder(response.Body).Decode(eventResponse)
+	})
+	if err == errorResponse && errorResponse != nil {
+		return nil, errorResponse, nil
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		// parse the error message and return
-		errorResponse := &EventResponseError{}
-		err = json.NewDecoder(response.Body).Decode(errorResponse)
-		return nil, errorResponse, err
-	}
-	// Copilot returns a 200 even if there are invalid events, so we need
-	// to determine if there are any invalid events and then return them
-
-	eventResponse := &EventResponse{}
-	err = json.NewDecoder(response.Body).Decode(eventResponse)
-	return eventResponse, nil, err
+	return eventResponse, nil, nil
 }
 
 // makeConsentCall makes a call to the consent endpoint, of which there is only one
 // call, so we take a simplified approach to this function as compared to the collection call
-func makeConsentCall(userID string, consentValue bool) error {
+func makeConsentCall(config *configStruct, userID string, consentValue bool, timestamp int64) error {
 	if config == nil {
 		return errors.New("copilot client not configured")
 	}
-	postBody, err := json.Marshal(map[string]interface{}{
-		"consent_value": consentValue,
-		"user_id":       userID,
-	})
+	// the consent has to be linked to the same pseudonym the events at the same time were sent with
+	userID = config.PrivacyPolicy.Pseudonymize(userID, time.UnixMilli(timestamp))
+	body := ConsentRequest{
+		ConsentValue: consentValue,
+		UserID:       userID,
+	}
+	if config.DryRun != nil {
+		return config.DryRun.Write(DryRunRecord{
+			Endpoint: config.ConsentEndpoint,
+			Consent:  &body,
+		})
+	}
+	postBody, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	httpBody := bytes.NewBuffer(postBody)
+	if _, err := config.CredentialProvider.Credentials(); err != nil {
+		return err
+	}
+
+	return config.consentPool.call(config, func(endpoint string) (int, error) {
+		response, err := postJSON(config, config.consentHTTP, endpoint, postBody)
+		if err != nil {
+			return 0, err
+		}
+		defer response.Body.Close()
 
-	req, err := http.NewRequest(http.MethodPost, config.ConsentEndpoint, httpBody)
+		if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+			// parse the error message and return
+			return response.StatusCode, &EndpointError{
+				Kind:       EndpointKindConsent,
+				Endpoint:   endpoint,
+				StatusCode: response.StatusCode,
+				Err:        fmt.Errorf("recevied a %d", response.StatusCode),
+			}
+		}
+		return response.StatusCode, nil
+	})
+}
+
+// postJSON posts the body to the endpoint with the client's credentials. If Copilot responds with a 401,
+// the credentials are refreshed and, if they changed, the request is retried once.
+func postJSON(config *configStruct, httpClient *http.Client, endpoint string, postBody []byte) (*http.Response, error) {
+	credentials, err := config.CredentialProvider.Credentials()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	response, err := postJSONWithCredentials(httpClient, endpoint, postBody, credentials)
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
 	}
-	req.SetBasicAuth(config.ClientID, config.ClientSecret)
-	req.Header.Add("content-type", "application/json")
 
-	// now make the call
-	response, err := httpClient.Do(req)
+	// keep the body of the 401 so it can be returned if the credentials cannot be refreshed
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	if err := config.CredentialProvider.Refresh(); err != nil {
+		log.Printf("copilot credentials could not be refreshed after a 401: %v", err)
+		return response, nil
+	}
+	refreshed, err := config.CredentialProvider.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	// the same credentials would only be rejected again
+	if refreshed == credentials {
+		return response, nil
+	}
+	return postJSONWithCredentials(httpClient, endpoint, postBody, refreshed)
+}
 
-	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
-		// parse the error message and return
-		return fmt.Errorf("recevied a %d", response.StatusCode)
+// postJSONWithCredentials makes a single request with the credentials
+func postJSONWithCredentials(httpClient *http.Client, endpoint string, postBody []byte, credentials Credentials) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(postBody))
+	if err != nil {
+		return nil, err
 	}
+	req.SetBasicAuth(credentials.ClientID, credentials.ClientSecret)
+	req.Header.Add("content-type", "application/json")
 
-	return nil
+	// now make the call
+	return httpClient.Do(req)
 }
@@ -0,0 +1,124 @@
+package copilot
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock provides the current time whenever a default timestamp is needed. It can be replaced with
+// WithClock, for example to make tests deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock, which uses the system time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// TimestampMode determines what happens to timestamps that look wrong
+type TimestampMode int
+
+// below are the supported timestamp modes
+const (
+	// TimestampAllow sends timestamps as they are provided. This is the default.
+	TimestampAllow TimestampMode = iota
+	// TimestampReject returns an error for timestamps that look like seconds or fall outside of the allowed range
+	TimestampReject
+	// TimestampCorrect converts timestamps that look like seconds to milliseconds and replaces timestamps
+	// outside of the allowed range with the current time
+	TimestampCorrect
+)
+
+// defaultMaxFutureSkew is how far in the future a timestamp can be when a policy does not set MaxFuture
+const defaultMaxFutureSkew = 24 * time.Hour
+
+// secondsThreshold is the cutoff below which a timestamp is assumed to be in seconds. In milliseconds it
+// is early 1973; in seconds it is thousands of years from now.
+const secondsThreshold = 100000000000
+
+// TimestampPolicy configures how timestamps are checked before events are sent
+type TimestampPolicy struct {
+	Mode TimestampMode
+	// MaxFuture is how far ahead of the clock a timestamp can be; it defaults to 24 hours
+	MaxFuture time.Duration
+	// MaxPast is how far behind the clock a timestamp can be; if 0, past timestamps are not checked
+	MaxPast time.Duration
+}
+
+// WithClock sets the Clock used whenever a default timestamp is needed
+func WithClock(clock Clock) Option {
+	return func(config *configStruct) {
+		config.Clock = clock
+	}
+}
+
+// WithTimestampPolicy sets how timestamps that look like seconds or are far in the future or past are handled
+func WithTimestampPolicy(policy TimestampPolicy) Option {
+	return func(config *configStruct) {
+		config.TimestampPolicy = policy
+	}
+}
+
+// Timestamp converts a time to the Unix milliseconds expected by the event calls. The zero time is converted
+// to 0, so the current time is used as the default.
+func Timestamp(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// now returns the current time from the clock configured with Setup
+func now() time.Time {
+	return config.now()
+}
+
+// now returns the current time from the configured clock
+func (config *configStruct) now() time.Time {
+	if config != nil && config.Clock != nil {
+		return config.Clock.Now()
+	}
+	return time.Now()
+}
+
+// resolveTimestamp defaults a 0 timestamp to the current time and applies the timestamp policy. It is called
+// once per event, before the event ID is generated, so that the ID and the timestamp always match.
+func (config *configStruct) resolveTimestamp(timestamp int64) (int64, error) {
+	current := config.now()
+	if timestamp == 0 {
+		return current.UnixMilli(), nil
+	}
+	if config == nil || config.TimestampPolicy.Mode == TimestampAllow {
+		return timestamp, nil
+	}
+	policy := config.TimestampPolicy
+	correct := policy.Mode == TimestampCorrect
+
+	if timestamp > 0 && timestamp < secondsThreshold {
+		if !correct {
+			return 0, fmt.Errorf("timestamp %d looks like it is in seconds instead of milliseconds", timestamp)
+		}
+		timestamp *= 1000
+	}
+
+	maxFuture := policy.MaxFuture
+	if maxFuture == 0 {
+		maxFuture = defaultMaxFutureSkew
+	}
+	if timestamp > current.Add(maxFuture).UnixMilli() {
+		if !correct {
+			return 0, fmt.Errorf("timestamp %d is more than %s in the future", timestamp, maxFuture)
+		}
+		return current.UnixMilli(), nil
+	}
+	if policy.MaxPast > 0 && timestamp < current.Add(-policy.MaxPast).UnixMilli() {
+		if !correct {
+			return 0, fmt.Errorf("timestamp %d is more than %s in the past", timestamp, policy.MaxPast)
+		}
+		return current.UnixMilli(), nil
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,79 @@
+package copilot_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (clock testClock) Now() time.Time {
+	return clock.now
+}
+
+func TestTimestamps(t *testing.T) {
+	userID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	now := time.Now()
+
+	assert.Equal(t, int64(0), copilot.Timestamp(time.Time{}))
+	assert.Equal(t, now.UnixMilli(), copilot.Timestamp(now))
+
+	// make sure the variants still check the required fields
+	err := copilot.UserCreatedAt("", now, "", nil)
+	assert.NotNil(t, err)
+	err = copilot.ThingAssociatedAt("", "", now, "")
+	assert.NotNil(t, err)
+
+	defer copilot.SaveConfig()()
+	sink := copilot.NewMemorySink()
+	err = copilot.Setup("", "", "", "", copilot.WithDryRun(sink),
+		copilot.WithClock(testClock{now: now}),
+		copilot.WithTimestampPolicy(copilot.TimestampPolicy{
+			Mode:    copilot.TimestampReject,
+			MaxPast: 24 * time.Hour,
+		}))
+	assert.Nil(t, err)
+
+	// seconds, far future and far past timestamps are rejected before anything is sent
+	err = copilot.UserCreated(userID, now.Unix(), "", nil)
+	assert.NotNil(t, err)
+	err = copilot.UserCreatedAt(userID, now.Add(48*time.Hour), "", nil)
+	assert.NotNil(t, err)
+	err = copilot.UserCreatedAt(userID, now.Add(-48*time.Hour), "", nil)
+	assert.NotNil(t, err)
+	assert.Empty(t, sink.Events())
+
+	// the clock is used for both the timestamp and the event ID
+	err = copilot.UserCreatedAt(userID, time.Time{}, "", nil)
+	assert.Nil(t, err)
+	events := sink.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, now.UnixMilli(), events[0].Timestamp)
+		assert.Equal(t, fmt.Sprintf("%s-%s-%d", copilot.EventTypeUserCreated, userID, now.UnixMilli()), events[0].EventID)
+	}
+
+	// when correcting, seconds are converted and out of range timestamps use the clock
+	err = copilot.Setup("", "", "", "", copilot.WithDryRun(sink),
+		copilot.WithClock(testClock{now: now}),
+		copilot.WithTimestampPolicy(copilot.TimestampPolicy{
+			Mode: copilot.TimestampCorrect,
+		}))
+	assert.Nil(t, err)
+	sink.Reset()
+	err = copilot.UserUpdated(userID, now.Unix(), "", nil)
+	assert.Nil(t, err)
+	err = copilot.UserUpdatedAt(userID, now.Add(48*time.Hour), "", nil)
+	assert.Nil(t, err)
+	events = sink.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, now.Unix()*1000, events[0].Timestamp)
+		assert.Equal(t, now.UnixMilli(), events[1].Timestamp)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/GetWagz/go-copilot"
+)
+
+const consentUsage = `usage: copilot consent bulk [flags]
+
+Updates the consent of every user in the input, which is either JSON lines with user_id and consent_value keys
+or a CSV of user_id,consent_value with an optional header. Each result is appended to the report, and running
+again with the same report skips the updates that already succeeded.`
+
+func runConsent(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "bulk" {
+		return errors.New(consentUsage)
+	}
+
+	flags := flag.NewFlagSet("consent bulk", flag.ContinueOnError)
+	input := flags.String("input", "-", "the file to read the updates from, or - for stdin")
+	format := flags.String("format", "jsonl", "the format of the input, jsonl or csv")
+	reportPath := flags.String("report", "", "the file to append the results to and resume from (required)")
+	concurrency := flags.Int("concurrency", 8, "the number of updates in flight at once")
+	rate := flags.Float64("rate", 0, "the maximum number of requests per second, or 0 for no limit")
+	attempts := flags.Int("attempts", 3, "the number of times each update is tried")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *reportPath == "" {
+		return errors.New("-report is required")
+	}
+	if *format != "jsonl" && *format != "csv" {
+		return fmt.Errorf("unknown format %s", *format)
+	}
+	if !copilot.IsSetUp() {
+		return errors.New("the COPILOT_CLIENT_* environment variables must be set to update consent")
+	}
+
+	reader := io.Reader(os.Stdin)
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	// resume from any results already in the report
+	report, err := os.OpenFile(*reportPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+	resume, err := copilot.ReadConsentReport(report)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	updates := make(chan copilot.ConsentUpdate)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(updates)
+		readErr <- readConsentUpdates(ctx, reader, *format, updates)
+	}()
+
+	summary, err := copilot.BulkUpdateConsent(ctx, updates, copilot.BulkConsentOptions{
+		Concurrency:   *concurrency,
+		RatePerSecond: *rate,
+		MaxAttempts:   *attempts,
+		Report:        report,
+		Resume:        resume,
+	})
+	fmt.Fprintf(stdout, "succeeded %d, failed %d, skipped %d\n", summary.Succeeded, summary.Failed, summary.Skipped)
+	if err != nil {
+		return err
+	}
+	return <-readErr
+}
+
+// readConsentUpdates parses the input and sends each update until the input ends or the context is canceled
+func readConsentUpdates(ctx context.Context, reader io.Reader, format string, updates chan<- copilot.ConsentUpdate) error {
+	send := func(update copilot.ConsentUpdate) bool {
+		select {
+		case updates <- update:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if format == "jsonl" {
+		scanner := bufio.NewScanner(reader)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			// the value is a pointer so that a missing one is not read as a withdrawal
+			update := struct {
+				UserID       string `json:"user_id"`
+				ConsentValue *bool  `json:"consent_value"`
+			}{}
+			if err := json.Unmarshal(scanner.Bytes(), &update); err != nil || update.UserID == "" {
+				return fmt.Errorf("line %d is not a valid update", line)
+			}
+			if update.ConsentValue == nil {
+				return fmt.Errorf("line %d is missing the consent_value", line)
+			}
+			if !send(copilot.ConsentUpdate{UserID: update.UserID, ConsentValue: *update.ConsentValue}) {
+				return nil
+			}
+		}
+		return scanner.Err()
+	}
+
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = 2
+	for line := 1; ; line++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseBool(strings.TrimSpace(record[1]))
+		if err != nil {
+			if line == 1 {
+				// the header
+				continue
+			}
+			return fmt.Errorf("line %d has an invalid consent value %s", line, record[1])
+		}
+		if !send(copilot.ConsentUpdate{UserID: strings.TrimSpace(record[0]), ConsentValue: value}) {
+			return nil
+		}
+	}
+}
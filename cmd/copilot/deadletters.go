@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+)
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+const deadLettersUsage = `usage: copilot deadletters <action> [flags]
+
+actions:
+  list      list every dead letter
+  groups    count the dead letters by rejection reason
+  show      print a dead letter as JSON; requires -id
+  fix       set or unset payload keys; requires -id or -reason
+  resubmit  send dead letters again, removing those accepted; requires -id, -reason or -all
+  remove    delete dead letters; requires -id, -reason or -all`
+
+func runDeadLetters(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(deadLettersUsage)
+	}
+	action := args[0]
+
+	flags := flag.NewFlagSet("deadletters "+action, flag.ContinueOnError)
+	dir := flags.String("dir", os.Getenv("COPILOT_CLIENT_DEAD_LETTER_DIR"), "the dead letter directory")
+	id := flags.String("id", "", "the dead letter to act on")
+	reason := flags.String("reason", "", "act on every dead letter rejected for this reason")
+	all := flags.Bool("all", false, "act on every dead letter")
+	set := stringList{}
+	flags.Var(&set, "set", "a payload key=value to set when fixing; the value is parsed as JSON if possible (repeatable)")
+	unset := stringList{}
+	flags.Var(&unset, "unset", "a payload key to remove when fixing (repeatable)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errors.New("the dead letter directory must be set with -dir or COPILOT_CLIENT_DEAD_LETTER_DIR")
+	}
+	store, err := copilot.NewFileDeadLetterStore(*dir)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		letters, err := store.ListDeadLetters()
+		if err != nil {
+			return err
+		}
+		return printDeadLetters(stdout, letters)
+	case "groups":
+		letters, err := store.ListDeadLetters()
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "COUNT\tREASON")
+		for _, group := range copilot.GroupDeadLetters(letters) {
+			fmt.Fprintf(writer, "%d\t%s\n", len(group.Letters), group.Reason)
+		}
+		return writer.Flush()
+	case "show":
+		letter, err := store.GetDeadLetter(*id)
+		if err != nil {
+			return err
+		}
+		if letter == nil {
+			return copilot.ErrDeadLetterNotFound
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(letter)
+	case "fix":
+		if len(set) == 0 && len(unset) == 0 {
+			return errors.New("fix requires at least one -set or -unset")
+		}
+		fix, err := payloadFix(set, unset)
+		if err != nil {
+			return err
+		}
+		ids, err := selectDeadLetters(store, *id, *reason, false)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := copilot.FixDeadLetter(store, id, fix); err != nil {
+				return fmt.Errorf("%s: %w", id, err)
+			}
+		}
+		fmt.Fprintf(stdout, "fixed %d dead letters\n", len(ids))
+		return nil
+	case "resubmit":
+		if !copilot.IsSetUp() {
+			return errors.New("the COPILOT_CLIENT_* environment variables must be set to resubmit")
+		}
+		ids, err := selectDeadLetters(store, *id, *reason, *all)
+		if err != nil {
+			return err
+		}
+		accepted := 0
+		for _, id := range ids {
+			err := copilot.ResubmitDeadLetter(store, id)
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: %v\n", id, err)
+				continue
+			}
+			accepted++
+		}
+		fmt.Fprintf(stdout, "resubmitted %d dead letters, %d accepted\n", len(ids), accepted)
+		return nil
+	case "remove":
+		ids, err := selectDeadLetters(store, *id, *reason, *all)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := store.RemoveDeadLetter(id); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(stdout, "removed %d dead letters\n", len(ids))
+		return nil
+	}
+	return fmt.Errorf("unknown action %s\n%s", action, deadLettersUsage)
+}
+
+// printDeadLetters writes the letters as a table
+func printDeadLetters(stdout io.Writer, letters []copilot.DeadLetter) error {
+	writer := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tTYPE\tEVENT ID\tREJECTED AT\tATTEMPTS\tERROR")
+	for _, letter := range letters {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			letter.ID,
+			letter.Event.Type,
+			letter.Event.EventID,
+			time.UnixMilli(letter.RejectedAt).UTC().Format(time.RFC3339),
+			letter.Attempts,
+			letter.Error,
+		)
+	}
+	return writer.Flush()
+}
+
+// selectDeadLetters returns the IDs selected by the flags; exactly one selector must be used
+func selectDeadLetters(store copilot.DeadLetterStore, id, reason string, all bool) ([]string, error) {
+	selectors := 0
+	for _, used := range []bool{id != "", reason != "", all} {
+		if used {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return nil, errors.New("exactly one of -id, -reason or -all must be provided")
+	}
+	if id != "" {
+		return []string{id}, nil
+	}
+	letters, err := store.ListDeadLetters()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, letter := range letters {
+		if all || letter.Error == reason {
+			ids = append(ids, letter.ID)
+		}
+	}
+	return ids, nil
+}
+
+// payloadFix builds a fix that sets and removes the payload keys
+func payloadFix(set, unset []string) (func(event *copilot.Event) error, error) {
+	values := map[string]interface{}{}
+	for _, pair := range set {
+		key, raw, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("-set %s must be formatted as key=value", pair)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		values[key] = value
+	}
+	return func(event *copilot.Event) error {
+		payload, ok := event.Payload.(map[string]interface{})
+		if !ok {
+			payload = map[string]interface{}{}
+		}
+		for key, value := range values {
+			payload[key] = value
+		}
+		for _, key := range unset {
+			delete(payload, key)
+		}
+		event.Payload = payload
+		return nil
+	}, nil
+}
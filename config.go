@@ -3,7 +3,10 @@ package copilot
 import (
 	"errors"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 // hold the configuration
@@ -12,8 +15,46 @@ type configStruct struct {
 	ClientSecret    string
 	CollectEndpoint string
 	ConsentEndpoint string
+	Clock           Clock
+	TimestampPolicy TimestampPolicy
+	PrivacyPolicy   *PrivacyPolicy
+	DeadLetters     DeadLetterStore
+	Associations    AssociationStore
+	Erasures        ErasureStore
+	Hierarchy       HierarchyStore
+
+	CredentialProvider CredentialProvider
+
+	HTTPClient     *http.Client
+	Transport      http.RoundTripper
+	CollectTimeout time.Duration
+	ConsentTimeout time.Duration
+	transport      transportSettings
+	collectHTTP    *http.Client
+	consentHTTP    *http.Client
+
+	// optionErrors holds any errors from applying the options, such as a certificate that could not be loaded
+	optionErrors []error
+
+	CollectFallbacks []string
+	ConsentFallbacks []string
+	EndpointCooldown time.Duration
+	RequestObserver  func(result RequestResult)
+	collectPool      *endpointPool
+	consentPool      *endpointPool
+
+	QueueSize    int
+	QueueWorkers int
+	OnSendError  func(event Event, err error)
+	sender       *sender
+
+	DryRun           DryRunSink
+	DryRunValidators []DryRunValidator
 }
 
+// Option configures optional behavior of the client when passed to Setup or NewClient
+type Option func(*configStruct)
+
 var config *configStruct = nil
 
 func init() {
@@ -24,27 +65,88 @@ func init() {
 	clientSecret := osHelper("COPILOT_CLIENT_SECRET", "")
 	collectEndpoint := osHelper("COPILOT_CLIENT_COLLECT_ENDPOINT", "")
 	consentEndpoint := osHelper("COPILOT_CLIENT_CONSENT_ENDPOINT", "")
-	Setup(clientID, clientSecret, collectEndpoint, consentEndpoint)
+	options := []Option{}
+	if osHelper("COPILOT_CLIENT_DRY_RUN", "") == "true" {
+		options = append(options, WithDryRun(LogSink(nil)))
+	}
+	collectFallbacks := splitList(osHelper("COPILOT_CLIENT_COLLECT_FALLBACK_ENDPOINTS", ""))
+	consentFallbacks := splitList(osHelper("COPILOT_CLIENT_CONSENT_FALLBACK_ENDPOINTS", ""))
+	if len(collectFallbacks) > 0 || len(consentFallbacks) > 0 {
+		options = append(options, WithFallbackEndpoints(collectFallbacks, consentFallbacks))
+	}
+	if path := osHelper("COPILOT_CLIENT_CREDENTIALS_FILE", ""); path != "" {
+		provider, err := FileCredentials(path, time.Minute)
+		if err != nil {
+			log.Printf("copilot credentials file could not be read: %v", err)
+		} else {
+			options = append(options, WithCredentialProvider(provider))
+		}
+	}
+	if dir := osHelper("COPILOT_CLIENT_DEAD_LETTER_DIR", ""); dir != "" {
+		store, err := NewFileDeadLetterStore(dir)
+		if err != nil {
+			log.Printf("copilot dead letter store could not be created: %v", err)
+		} else {
+			options = append(options, WithDeadLetterStore(store))
+		}
+	}
+	Setup(clientID, clientSecret, collectEndpoint, consentEndpoint, options...)
 }
 
 // Setup is called on init from the environment but can also be called explicitly
-// by tests or the client
-func Setup(clientID string, clientSecret string, collectEndpoint, consentEndpoint string) error {
-	// if they are missing, we want to log an error but we shouldn't
-	// nuke the caller through a panic
-	if clientID == "" || clientSecret == "" || collectEndpoint == "" {
-		message := "copilot requires the client credentials and endpoint to be configured; no calls will be processed"
-		log.Print(message)
-		return errors.New(message)
+// by tests or the client. Any options are applied on top of the defaults. If the
+// previous configuration had background sending, it is closed once its queued
+// events are sent.
+func Setup(clientID string, clientSecret string, collectEndpoint, consentEndpoint string, options ...Option) error {
+	newConfig, err := newConfig(clientID, clientSecret, collectEndpoint, consentEndpoint, options...)
+	if err != nil {
+		return err
 	}
+	if config != nil {
+		config.sender.closeReplaced()
+	}
+	config = newConfig
+	return nil
+}
 
-	config = &configStruct{
+// newConfig builds and verifies a configuration for Setup or NewClient
+func newConfig(clientID string, clientSecret string, collectEndpoint, consentEndpoint string, options ...Option) (*configStruct, error) {
+	newConfig := &configStruct{
 		ClientID:        clientID,
 		ClientSecret:    clientSecret,
 		CollectEndpoint: collectEndpoint,
 		ConsentEndpoint: consentEndpoint,
+		Clock:           systemClock{},
 	}
-	return nil
+	for _, option := range options {
+		option(newConfig)
+	}
+	if len(newConfig.optionErrors) > 0 {
+		return nil, newConfig.optionErrors[0]
+	}
+	if err := newConfig.buildHTTPClients(); err != nil {
+		return nil, err
+	}
+
+	// if they are missing, we want to log an error but we shouldn't
+	// nuke the caller through a panic; in dry run mode nothing is sent,
+	// so they are not needed
+	missingCredentials := newConfig.CredentialProvider == nil && (clientID == "" || clientSecret == "")
+	if newConfig.DryRun == nil && (missingCredentials || collectEndpoint == "") {
+		message := "copilot requires the client credentials and endpoint to be configured; no calls will be processed"
+		log.Print(message)
+		return nil, errors.New(message)
+	}
+	if newConfig.CredentialProvider == nil {
+		newConfig.CredentialProvider = StaticCredentials(clientID, clientSecret)
+	}
+	newConfig.collectPool = newEndpointPool(EndpointKindCollect, newConfig.CollectEndpoint, newConfig.CollectFallbacks)
+	newConfig.consentPool = newEndpointPool(EndpointKindConsent, newConfig.ConsentEndpoint, newConfig.ConsentFallbacks)
+	if newConfig.Erasures == nil {
+		newConfig.Erasures = NewMemoryErasureStore()
+	}
+	newConfig.sender = newSender(newConfig)
+	return newConfig, nil
 }
 
 // IsSetUp is a helper to determine if the copilot client is configured. Note that this
@@ -62,6 +164,18 @@ func osHelper(key, defaultValue string) string {
 	return found
 }
 
+// splitList splits a comma separated environment variable, dropping blank entries
+func splitList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // String takes a string and converts it to a pointer to be used
 // in the parameter passing
 func String(str string) *string {
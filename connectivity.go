@@ -0,0 +1,412 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// below are the status key and values sent by the ConnectivityMonitor
+const (
+	ConnectivityStatusKey = "connectivity"
+	ConnectivityOnline    = "online"
+	ConnectivityOffline   = "offline"
+)
+
+// defaultConnectivityOfflineAttempts is the number of times an offline status is tried by default
+const defaultConnectivityOfflineAttempts = 3
+
+// ConnectivitySession is a single period of time in which a thing was connected
+type ConnectivitySession struct {
+	ThingID string `json:"thing_id"`
+	UserID  string `json:"user_id,omitempty"`
+	// ConnectedAt and DisconnectedAt are Unix timestamps in milliseconds. DisconnectedAt is 0 while the session is active.
+	ConnectedAt    int64         `json:"connected_at"`
+	DisconnectedAt int64         `json:"disconnected_at,omitempty"`
+	Duration       time.Duration `json:"duration"`
+}
+
+// ConnectivityMonitorConfig configures a ConnectivityMonitor
+type ConnectivityMonitorConfig struct {
+	// HeartbeatTimeout is how long a thing can go without a heartbeat before it is marked offline. If 0, things are
+	// only marked offline when Disconnected is called.
+	HeartbeatTimeout time.Duration
+	// StatusKey is the status key sent on ThingStatusChanged; it defaults to ConnectivityStatusKey
+	StatusKey string
+	// OnSessionEnded, if set, is called with each session once the thing goes offline
+	OnSessionEnded func(ConnectivitySession)
+	// OnError is called with any errors from marking things offline in the background. It defaults to logging the error.
+	OnError func(error)
+	// OfflineMaxAttempts is the number of times an offline status that fails to send is tried before the thing is
+	// left offline without it; it defaults to 3. The heartbeat timeout retries it, waiting twice as long each time.
+	// An offline status that Copilot rejects is dead lettered and not retried.
+	OfflineMaxAttempts int
+	// CascadeToChildren sends the connectivity status of a thing to all of its descendants in the hierarchy store
+	// configured with WithThingHierarchy whenever it comes online or goes offline, such as the sensors behind a hub
+	CascadeToChildren bool
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+}
+
+// ConnectivityMonitor tracks whether things are connected based on heartbeats or explicit connect and disconnect
+// signals. When a thing comes online, ThingConnected is sent along with a connectivity status change. When it
+// disconnects or its heartbeats stop, an offline connectivity status change is sent and the session is ended.
+type ConnectivityMonitor struct {
+	config ConnectivityMonitorConfig
+
+	lock   sync.Mutex
+	things map[string]*thingConnectivity
+}
+
+// thingConnectivity is the tracked state of a single thing
+type thingConnectivity struct {
+	userID      string
+	online      bool
+	connectedAt int64
+	lastSeen    int64
+	timer       *time.Timer
+	// offlineAttempts is the number of times the offline status has failed to send since the last heartbeat
+	offlineAttempts int
+	// generation changes on every transition so stale timers and failed sends can be detected
+	generation int
+}
+
+// NewConnectivityMonitor creates a new monitor with the provided configuration
+func NewConnectivityMonitor(config ConnectivityMonitorConfig) *ConnectivityMonitor {
+	if config.StatusKey == "" {
+		config.StatusKey = ConnectivityStatusKey
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Printf("copilot connectivity change could not be sent: %v", err)
+		}
+	}
+	if config.OfflineMaxAttempts <= 0 {
+		config.OfflineMaxAttempts = defaultConnectivityOfflineAttempts
+	}
+	return &ConnectivityMonitor{
+		config: config,
+		things: map[string]*thingConnectivity{},
+	}
+}
+
+// Heartbeat tells the monitor the thing is still connected. If the thing was offline, it is marked online.
+func (monitor *ConnectivityMonitor) Heartbeat(thingID, userID string, timestamp int64) error {
+	return monitor.Connected(thingID, userID, timestamp)
+}
+
+// Connected tells the monitor the thing has connected. If the thing was offline, ThingConnected and an online
+// connectivity status are sent. The userID is optional.
+func (monitor *ConnectivityMonitor) Connected(thingID, userID string, timestamp int64) error {
+	if thingID == "" {
+		return errors.New("thingID cannot be blank")
+	}
+	timestamp, err := monitor.config.Client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
+	monitor.lock.Lock()
+	thing, found := monitor.things[thingID]
+	if !found {
+		thing = &thingConnectivity{}
+		monitor.things[thingID] = thing
+	}
+	if userID != "" {
+		thing.userID = userID
+	}
+	if timestamp > thing.lastSeen {
+		thing.lastSeen = timestamp
+	}
+	thing.offlineAttempts = 0
+	monitor.resetTimer(thingID, thing)
+	if thing.online {
+		monitor.lock.Unlock()
+		return nil
+	}
+	thing.online = true
+	thing.connectedAt = timestamp
+	thing.generation++
+	generation := thing.generation
+	userID = thing.userID
+	monitor.lock.Unlock()
+
+	err = monitor.config.Client.ThingConnected(thingID, userID, timestamp, "")
+	if err == nil {
+		err = monitor.sendStatus(thingID, userID, ConnectivityOnline, timestamp)
+	}
+	if err != nil {
+		// revert so the next heartbeat tries again
+		monitor.lock.Lock()
+		if thing.generation == generation {
+			thing.online = false
+			thing.generation++
+		}
+		monitor.lock.Unlock()
+		return err
+	}
+	return monitor.cascade(thingID, ConnectivityOnline, timestamp)
+}
+
+// Disconnected tells the monitor the thing has disconnected. If the thing was online, an offline connectivity
+// status is sent and the session is ended.
+func (monitor *ConnectivityMonitor) Disconnected(thingID string, timestamp int64) error {
+	if thingID == "" {
+		return errors.New("thingID cannot be blank")
+	}
+	timestamp, err := monitor.config.Client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	return monitor.markOffline(thingID, timestamp, -1)
+}
+
+// Online returns true if the thing is currently considered connected
+func (monitor *ConnectivityMonitor) Online(thingID string) bool {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	thing, found := monitor.things[thingID]
+	return found && thing.online
+}
+
+// Session returns the active session for the thing, if it is online
+func (monitor *ConnectivityMonitor) Session(thingID string) (ConnectivitySession, bool) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	thing, found := monitor.things[thingID]
+	if !found || !thing.online {
+		return ConnectivitySession{}, false
+	}
+	return ConnectivitySession{
+		ThingID:     thingID,
+		UserID:      thing.userID,
+		ConnectedAt: thing.connectedAt,
+		Duration:    time.Duration(thing.lastSeen-thing.connectedAt) * time.Millisecond,
+	}, true
+}
+
+// Stop cancels all of the heartbeat timeouts. No offline events are sent for things that are still online.
+func (monitor *ConnectivityMonitor) Stop() {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	for _, thing := range monitor.things {
+		if thing.timer != nil {
+			thing.timer.Stop()
+			thing.timer = nil
+		}
+	}
+}
+
+// resetTimer restarts the heartbeat timeout for the thing, doubling it for each failed offline attempt; the lock
+// must be held
+func (monitor *ConnectivityMonitor) resetTimer(thingID string, thing *thingConnectivity) {
+	if monitor.config.HeartbeatTimeout <= 0 {
+		return
+	}
+	if thing.timer != nil {
+		thing.timer.Stop()
+	}
+	timeout := monitor.config.HeartbeatTimeout
+	for i := 0; i < thing.offlineAttempts && i < 10; i++ {
+		timeout *= 2
+	}
+	lastSeen := thing.lastSeen
+	thing.timer = time.AfterFunc(timeout, func() {
+		// the session ends at the last heartbeat, not when we noticed it was missing
+		if err := monitor.markOffline(thingID, lastSeen, lastSeen); err != nil {
+			monitor.config.OnError(err)
+		}
+	})
+}
+
+// markOffline ends the session for the thing. If expectedLastSeen is not -1, the thing is only marked offline
+// if no heartbeat has arrived since.
+func (monitor *ConnectivityMonitor) markOffline(thingID string, timestamp int64, expectedLastSeen int64) error {
+	monitor.lock.Lock()
+	thing, found := monitor.things[thingID]
+	if !found || !thing.online || (expectedLastSeen != -1 && thing.lastSeen != expectedLastSeen) {
+		monitor.lock.Unlock()
+		return nil
+	}
+	thing.online = false
+	thing.generation++
+	generation := thing.generation
+	if thing.timer != nil {
+		thing.timer.Stop()
+		thing.timer = nil
+	}
+	session := ConnectivitySession{
+		ThingID:        thingID,
+		UserID:         thing.userID,
+		ConnectedAt:    thing.connectedAt,
+		DisconnectedAt: timestamp,
+		Duration:       time.Duration(timestamp-thing.connectedAt) * time.Millisecond,
+	}
+	monitor.lock.Unlock()
+
+	err := monitor.sendStatus(thingID, session.UserID, ConnectivityOffline, timestamp)
+	if err != nil {
+		monitor.lock.Lock()
+		if thing.generation != generation {
+			monitor.lock.Unlock()
+			return err
+		}
+		thing.offlineAttempts++
+		attempts := thing.offlineAttempts
+		var invalid *InvalidEventError
+		if !errors.As(err, &invalid) && attempts < monitor.config.OfflineMaxAttempts {
+			// revert so a later disconnect or timeout tries again
+			thing.online = true
+			thing.generation++
+			monitor.resetTimer(thingID, thing)
+			monitor.lock.Unlock()
+			return err
+		}
+		// give up, since a rejected status was dead lettered and would only be rejected again
+		thing.offlineAttempts = 0
+		monitor.lock.Unlock()
+		if monitor.config.OnSessionEnded != nil {
+			monitor.config.OnSessionEnded(session)
+		}
+		return fmt.Errorf("%s was marked offline after its status failed to send %d times: %w", thingID, attempts, err)
+	}
+	if monitor.config.OnSessionEnded != nil {
+		monitor.config.OnSessionEnded(session)
+	}
+	return monitor.cascade(thingID, ConnectivityOffline, timestamp)
+}
+
+// cascadedThing is a descendant whose connectivity was changed by a cascade
+type cascadedThing struct {
+	thingID    string
+	thing      *thingConnectivity
+	generation int
+	userID     string
+	session    *ConnectivitySession
+	// hadTimer is true when the thing had its own heartbeat timeout, which is restored if the cascade fails
+	hadTimer bool
+}
+
+// cascade sends the connectivity status of the parent to each of its descendants whose tracked status differs, in
+// a single request. The descendants are tracked as if they had connected or disconnected themselves, except that
+// they have no heartbeat timeout of their own.
+func (monitor *ConnectivityMonitor) cascade(parentID string, value string, timestamp int64) error {
+	if !monitor.config.CascadeToChildren {
+		return nil
+	}
+	config := monitor.config.Client.configuration()
+	if config == nil || config.Hierarchy == nil {
+		return nil
+	}
+	descendants, err := thingDescendants(config.Hierarchy, parentID)
+	if err != nil {
+		return err
+	}
+
+	online := value == ConnectivityOnline
+	changed := []cascadedThing{}
+	monitor.lock.Lock()
+	for _, childID := range descendants {
+		thing, found := monitor.things[childID]
+		if !found {
+			thing = &thingConnectivity{}
+			monitor.things[childID] = thing
+		}
+		if thing.online == online {
+			continue
+		}
+		thing.online = online
+		thing.generation++
+		cascaded := cascadedThing{
+			thingID:    childID,
+			thing:      thing,
+			generation: thing.generation,
+			userID:     thing.userID,
+		}
+		if online {
+			thing.connectedAt = timestamp
+			thing.lastSeen = timestamp
+		} else {
+			if thing.timer != nil {
+				thing.timer.Stop()
+				thing.timer = nil
+				cascaded.hadTimer = true
+			}
+			cascaded.session = &ConnectivitySession{
+				ThingID:        childID,
+				UserID:         thing.userID,
+				ConnectedAt:    thing.connectedAt,
+				DisconnectedAt: timestamp,
+				Duration:       time.Duration(timestamp-thing.connectedAt) * time.Millisecond,
+			}
+		}
+		changed = append(changed, cascaded)
+	}
+	monitor.lock.Unlock()
+	if len(changed) == 0 {
+		return nil
+	}
+
+	events := []Event{}
+	for _, cascaded := range changed {
+		payload := &ThingStatusChangedPayload{
+			ThingID:      String(cascaded.thingID),
+			StatusKey:    String(monitor.config.StatusKey),
+			StatusValue:  String(value),
+			StatusDate:   Int64(timestamp),
+			CascadedFrom: String(parentID),
+		}
+		if cascaded.userID != "" {
+			payload.UserID = String(cascaded.userID)
+		}
+		events = append(events, Event{
+			EventID:   uniqueEventID(EventTypeThingStatusChanged, timestamp, cascaded.thingID, value),
+			Type:      EventTypeThingStatusChanged,
+			Timestamp: timestamp,
+			Payload:   payload,
+		})
+	}
+	rejected, err := monitor.config.Client.sendEvents(events)
+	if err != nil {
+		// revert so the next transition of the parent tries again
+		monitor.lock.Lock()
+		for _, cascaded := range changed {
+			if cascaded.thing.generation == cascaded.generation {
+				cascaded.thing.online = !online
+				cascaded.thing.generation++
+				if cascaded.hadTimer {
+					monitor.resetTimer(cascaded.thingID, cascaded.thing)
+				}
+			}
+		}
+		monitor.lock.Unlock()
+		return err
+	}
+	for index, cascaded := range changed {
+		if _, found := rejected[index]; !found && cascaded.session != nil && monitor.config.OnSessionEnded != nil {
+			monitor.config.OnSessionEnded(*cascaded.session)
+		}
+	}
+	if len(rejected) > 0 {
+		return &BatchError{
+			Events:   events,
+			Rejected: rejected,
+		}
+	}
+	return nil
+}
+
+// sendStatus sends the connectivity status change
+func (monitor *ConnectivityMonitor) sendStatus(thingID, userID, value string, timestamp int64) error {
+	payload := &ThingStatusChangedPayload{
+		StatusKey:   String(monitor.config.StatusKey),
+		StatusValue: String(value),
+	}
+	if userID != "" {
+		payload.UserID = String(userID)
+	}
+	eventID := uniqueEventID(EventTypeThingStatusChanged, timestamp, thingID, value)
+	return monitor.config.Client.ThingStatusChanged(thingID, timestamp, eventID, payload)
+}
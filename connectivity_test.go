@@ -0,0 +1,147 @@
+package copilot_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectivityMonitor(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	timestamp := time.Now().UnixMilli()
+
+	sessions := make(chan copilot.ConnectivitySession, 1)
+	monitor := copilot.NewConnectivityMonitor(copilot.ConnectivityMonitorConfig{
+		HeartbeatTimeout: 20 * time.Millisecond,
+		OnSessionEnded: func(session copilot.ConnectivitySession) {
+			sessions <- session
+		},
+		Client: recorder.Client,
+	})
+	defer monitor.Stop()
+
+	// make sure the thingID is set
+	err := monitor.Heartbeat("", "user-1", timestamp)
+	assert.NotNil(t, err)
+	err = monitor.Disconnected("", timestamp)
+	assert.NotNil(t, err)
+	// disconnecting a thing that never connected is a no-op
+	err = monitor.Disconnected("thing-1", timestamp)
+	assert.Nil(t, err)
+	assert.False(t, monitor.Online("thing-1"))
+	assert.Empty(t, recorder.Records())
+
+	err = monitor.Connected("thing-1", "user-1", timestamp)
+	assert.Nil(t, err)
+	err = monitor.Heartbeat("thing-1", "", timestamp+5000)
+	assert.Nil(t, err)
+	assert.True(t, monitor.Online("thing-1"))
+	session, found := monitor.Session("thing-1")
+	assert.True(t, found)
+	assert.Equal(t, 5*time.Second, session.Duration)
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeThingConnected), 1)
+	recorder.AssertEmitted(t, copilot.EventTypeThingStatusChanged, "user-1", map[string]interface{}{
+		"thing_id":     "thing-1",
+		"status_key":   copilot.ConnectivityStatusKey,
+		"status_value": copilot.ConnectivityOnline,
+	})
+
+	// once the heartbeats stop, the thing is marked offline
+	select {
+	case session = <-sessions:
+		assert.Equal(t, timestamp+5000, session.DisconnectedAt)
+		assert.Equal(t, 5*time.Second, session.Duration)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the session was never ended")
+	}
+	assert.False(t, monitor.Online("thing-1"))
+	recorder.AssertEmitted(t, copilot.EventTypeThingStatusChanged, "user-1", map[string]interface{}{
+		"thing_id":     "thing-1",
+		"status_value": copilot.ConnectivityOffline,
+	})
+}
+
+func TestConnectivityMonitorEventIDs(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	monitor := copilot.NewConnectivityMonitor(copilot.ConnectivityMonitorConfig{
+		Client: recorder.Client,
+	})
+	defer monitor.Stop()
+
+	// every transition of a flaky thing with a long ID keeps a distinct event ID
+	thingID := "3f2b8c1e-9a4d-4c1b-8e2f-123456789abc"
+	timestamp := int64(1600000000000)
+	for i := int64(0); i < 3; i++ {
+		assert.Nil(t, monitor.Connected(thingID, "", timestamp+i*2000))
+		assert.Nil(t, monitor.Disconnected(thingID, timestamp+i*2000+1000))
+	}
+	events := recorder.EventsOfType(copilot.EventTypeThingStatusChanged)
+	assert.Len(t, events, 6)
+	ids := map[string]bool{}
+	for _, event := range events {
+		assert.LessOrEqual(t, len(event.EventID), 50)
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, 6)
+}
+
+func TestConnectivityMonitorOfflineRetries(t *testing.T) {
+	deadLetters := copilot.NewMemoryDeadLetterStore()
+	recorder := copilottest.NewRecorder(copilot.WithDeadLetterStore(deadLetters))
+	timestamp := time.Now().UnixMilli()
+
+	errs := make(chan error, 10)
+	sessions := make(chan copilot.ConnectivitySession, 10)
+	monitor := copilot.NewConnectivityMonitor(copilot.ConnectivityMonitorConfig{
+		HeartbeatTimeout: 30 * time.Millisecond,
+		OnSessionEnded: func(session copilot.ConnectivitySession) {
+			sessions <- session
+		},
+		OnError: func(err error) {
+			errs <- err
+		},
+		Client: recorder.Client,
+	})
+	defer monitor.Stop()
+
+	// a failing offline status is retried by the timeout until the attempts run out
+	assert.Nil(t, monitor.Connected("thing-1", "user-1", timestamp))
+	recorder.Reset()
+	recorder.FailOn(copilot.EventTypeThingStatusChanged, errors.New("copilot is down"), -1)
+	select {
+	case session := <-sessions:
+		assert.Equal(t, "thing-1", session.ThingID)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the session was never ended")
+	}
+	assert.Len(t, errs, 3)
+	assert.False(t, monitor.Online("thing-1"))
+	recorder.AssertNotEmitted(t, copilot.EventTypeThingStatusChanged, "user-1")
+	recorder.ClearFailures()
+
+	// a rejected offline status is dead lettered and not retried
+	recorder.Reset()
+	for len(errs) > 0 {
+		<-errs
+	}
+	assert.Nil(t, monitor.Connected("thing-2", "user-2", timestamp))
+	recorder.RejectOn(copilot.EventTypeThingStatusChanged, "thing is unknown")
+	select {
+	case session := <-sessions:
+		assert.Equal(t, "thing-2", session.ThingID)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the session was never ended")
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, errs, 1)
+	assert.False(t, monitor.Online("thing-2"))
+	letters, err := deadLetters.ListDeadLetters()
+	assert.Nil(t, err)
+	if assert.Len(t, letters, 1) {
+		assert.Equal(t, copilot.EventTypeThingStatusChanged, letters[0].Event.Type)
+	}
+}
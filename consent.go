@@ -3,5 +3,26 @@ package copilot
 // UpdateUserConsent updates the user's consent using the consent endpoint
 // https://docs.copilot.cx/docs/server-api-your-own/reference/consent-api-reference
 func UpdateUserConsent(userID string, consentValue bool) error {
-	return makeConsentCall(userID, consentValue)
+	return DefaultClient().UpdateUserConsent(userID, consentValue)
+}
+
+// UpdateUserConsent is the same as the package level UpdateUserConsent, using the client's configuration
+func (client *Client) UpdateUserConsent(userID string, consentValue bool) error {
+	return client.updateUserConsent(userID, consentValue, 0)
+}
+
+// updateUserConsent updates the consent as of the timestamp, which picks the pseudonym when the privacy policy
+// rotates them, so that it matches the events sent at the same time
+func (client *Client) updateUserConsent(userID string, consentValue bool, timestamp int64) error {
+	config := client.configuration()
+	if config == nil {
+		return makeConsentCall(nil, userID, consentValue, timestamp)
+	}
+	timestamp, err := config.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	return config.sender.do(func() error {
+		return makeConsentCall(config, userID, consentValue, timestamp)
+	})
 }
@@ -0,0 +1,251 @@
+package copilot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// below are the legal bases for processing from Article 6 of the GDPR, for use in ConsentEntry.LegalBasis
+const (
+	LegalBasisConsent             = "consent"
+	LegalBasisContract            = "contract"
+	LegalBasisLegalObligation     = "legal_obligation"
+	LegalBasisVitalInterests      = "vital_interests"
+	LegalBasisPublicTask          = "public_task"
+	LegalBasisLegitimateInterests = "legitimate_interests"
+)
+
+// ConsentEntry is a single change to a user's consent, kept as proof of when and how it was given or withdrawn
+type ConsentEntry struct {
+	UserID       string `json:"user_id"`
+	ConsentValue bool   `json:"consent_value"`
+	// Timestamp is the Unix timestamp in milliseconds of the change; it defaults to now
+	Timestamp int64 `json:"timestamp"`
+	// Source is the channel the change came through, such as signup_form, settings_page or gpc
+	Source string `json:"source"`
+	// LegalBasis is the basis for processing, such as LegalBasisConsent
+	LegalBasis string `json:"legal_basis,omitempty"`
+	// Actor is who made the change, such as the user, a support agent or an automated process
+	Actor string `json:"actor,omitempty"`
+	Note  string `json:"note,omitempty"`
+}
+
+// ConsentExport is the consent history of a user, for a data subject access request
+type ConsentExport struct {
+	UserID     string         `json:"user_id"`
+	ExportedAt int64          `json:"exported_at"`
+	Current    *ConsentEntry  `json:"current"`
+	History    []ConsentEntry `json:"history"`
+}
+
+// ConsentLedgerStore is an append-only store of consent entries. Implement it to keep the ledger in a database.
+type ConsentLedgerStore interface {
+	AppendConsent(entry ConsentEntry) error
+	// ConsentHistory returns every entry for the user, in the order they were appended
+	ConsentHistory(userID string) ([]ConsentEntry, error)
+}
+
+// MemoryConsentLedgerStore is an in-memory ConsentLedgerStore, mostly useful for tests
+type MemoryConsentLedgerStore struct {
+	lock    sync.RWMutex
+	entries map[string][]ConsentEntry
+}
+
+// NewMemoryConsentLedgerStore creates an empty in-memory consent ledger store
+func NewMemoryConsentLedgerStore() *MemoryConsentLedgerStore {
+	return &MemoryConsentLedgerStore{
+		entries: map[string][]ConsentEntry{},
+	}
+}
+
+// AppendConsent adds the entry to the user's history
+func (store *MemoryConsentLedgerStore) AppendConsent(entry ConsentEntry) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.entries[entry.UserID] = append(store.entries[entry.UserID], entry)
+	return nil
+}
+
+// ConsentHistory returns a copy of every entry for the user
+func (store *MemoryConsentLedgerStore) ConsentHistory(userID string) ([]ConsentEntry, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	history := make([]ConsentEntry, len(store.entries[userID]))
+	copy(history, store.entries[userID])
+	return history, nil
+}
+
+// FileConsentLedgerStore appends each entry to a file as a line of JSON. The file is only ever appended to.
+type FileConsentLedgerStore struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileConsentLedgerStore creates a store that appends to the file, creating it if needed
+func NewFileConsentLedgerStore(path string) (*FileConsentLedgerStore, error) {
+	if path == "" {
+		return nil, errors.New("path cannot be blank")
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return &FileConsentLedgerStore{
+		path: path,
+	}, nil
+}
+
+// AppendConsent appends the entry to the file and syncs it to disk
+func (store *FileConsentLedgerStore) AppendConsent(entry ConsentEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	file, err := os.OpenFile(store.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ConsentHistory reads every entry for the user from the file
+func (store *FileConsentLedgerStore) ConsentHistory(userID string) ([]ConsentEntry, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	file, err := os.Open(store.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	history := []ConsentEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := ConsentEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("consent ledger line %d could not be read: %w", line, err)
+		}
+		if entry.UserID == userID {
+			history = append(history, entry)
+		}
+	}
+	return history, scanner.Err()
+}
+
+// ConsentLedger records every consent change in a store before pushing it to Copilot's consent endpoint
+type ConsentLedger struct {
+	store ConsentLedgerStore
+	// Client sends the consent updates; if nil, the default client is used
+	Client *Client
+}
+
+// NewConsentLedger creates a ledger that records to the store
+func NewConsentLedger(store ConsentLedgerStore) (*ConsentLedger, error) {
+	if store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+	return &ConsentLedger{
+		store: store,
+	}, nil
+}
+
+// Record appends the entry to the ledger and then calls UpdateUserConsent. The entry is kept even if the update
+// fails, since the change still happened; call Resync to push the current value again.
+func (ledger *ConsentLedger) Record(entry ConsentEntry) error {
+	if entry.UserID == "" {
+		return errors.New("userID cannot be blank")
+	}
+	if entry.Source == "" {
+		return errors.New("source cannot be blank")
+	}
+	timestamp, err := ledger.Client.resolveTimestamp(entry.Timestamp)
+	if err != nil {
+		return err
+	}
+	entry.Timestamp = timestamp
+	if err := ledger.store.AppendConsent(entry); err != nil {
+		return err
+	}
+	return ledger.Client.updateUserConsent(entry.UserID, entry.ConsentValue, entry.Timestamp)
+}
+
+// History returns every entry for the user, in the order they were recorded
+func (ledger *ConsentLedger) History(userID string) ([]ConsentEntry, error) {
+	if userID == "" {
+		return nil, errors.New("userID cannot be blank")
+	}
+	return ledger.store.ConsentHistory(userID)
+}
+
+// Current returns the most recently recorded entry for the user, or nil if none have been recorded
+func (ledger *ConsentLedger) Current(userID string) (*ConsentEntry, error) {
+	history, err := ledger.History(userID)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return &history[len(history)-1], nil
+}
+
+// Resync pushes the user's current consent to Copilot again, such as after Record failed to. It is sent as of the
+// entry's timestamp, like Record, so a rotating pseudonym key gives the same pseudonym as the original update.
+func (ledger *ConsentLedger) Resync(userID string) error {
+	current, err := ledger.Current(userID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("no consent has been recorded for %s", userID)
+	}
+	return ledger.Client.updateUserConsent(userID, current.ConsentValue, current.Timestamp)
+}
+
+// Export returns the user's consent history, for a data subject access request
+func (ledger *ConsentLedger) Export(userID string) (*ConsentExport, error) {
+	history, err := ledger.History(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &ConsentExport{
+		UserID:     userID,
+		ExportedAt: ledger.Client.now().UnixMilli(),
+		History:    history,
+	}
+	if len(history) > 0 {
+		export.Current = &history[len(history)-1]
+	}
+	return export, nil
+}
+
+// ExportJSON writes the user's consent history to the writer as indented JSON
+func (ledger *ConsentLedger) ExportJSON(userID string, w io.Writer) error {
+	export, err := ledger.Export(userID)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
@@ -0,0 +1,114 @@
+package copilot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsentLedger(t *testing.T) {
+	_, err := copilot.NewConsentLedger(nil)
+	assert.NotNil(t, err)
+
+	store, err := copilot.NewFileConsentLedgerStore(filepath.Join(t.TempDir(), "consent.jsonl"))
+	assert.Nil(t, err)
+	ledger, err := copilot.NewConsentLedger(store)
+	assert.Nil(t, err)
+	recorder := copilottest.NewRecorder()
+	ledger.Client = recorder.Client
+
+	// the source is required
+	err = ledger.Record(copilot.ConsentEntry{UserID: "user-1", ConsentValue: true})
+	assert.NotNil(t, err)
+
+	err = ledger.Record(copilot.ConsentEntry{
+		UserID:       "user-1",
+		ConsentValue: true,
+		Timestamp:    1600000000000,
+		Source:       "signup_form",
+		LegalBasis:   copilot.LegalBasisConsent,
+		Actor:        "user",
+	})
+	assert.Nil(t, err)
+	recorder.AssertConsent(t, "user-1", true)
+	err = ledger.Record(copilot.ConsentEntry{UserID: "user-2", ConsentValue: true, Source: "signup_form"})
+	assert.Nil(t, err)
+
+	// a failed update is still recorded and can be resynced
+	recorder.FailNext(errors.New("copilot is down"))
+	err = ledger.Record(copilot.ConsentEntry{UserID: "user-1", ConsentValue: false, Source: "settings_page", Actor: "support"})
+	assert.NotNil(t, err)
+	current, err := ledger.Current("user-1")
+	assert.Nil(t, err)
+	assert.False(t, current.ConsentValue)
+	assert.NotZero(t, current.Timestamp)
+	assert.Nil(t, ledger.Resync("user-1"))
+	recorder.AssertConsent(t, "user-1", false)
+	assert.NotNil(t, ledger.Resync("user-3"))
+
+	history, err := ledger.History("user-1")
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "signup_form", history[0].Source)
+	assert.Equal(t, int64(1600000000000), history[0].Timestamp)
+
+	buffer := &bytes.Buffer{}
+	assert.Nil(t, ledger.ExportJSON("user-1", buffer))
+	export := copilot.ConsentExport{}
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), &export))
+	assert.Equal(t, "user-1", export.UserID)
+	assert.Len(t, export.History, 2)
+	assert.Equal(t, "support", export.Current.Actor)
+}
+
+func TestConsentLedgerResyncPseudonym(t *testing.T) {
+	policy := copilot.PrivacyPolicy{
+		PseudonymKey: copilot.RotatingPseudonymKey([]byte("pseudonym-key"), 24*time.Hour),
+	}
+	recorder := copilottest.NewRecorder(copilot.WithPrivacyPolicy(policy))
+	ledger, err := copilot.NewConsentLedger(copilot.NewMemoryConsentLedgerStore())
+	assert.Nil(t, err)
+	ledger.Client = recorder.Client
+
+	// a resync long after the entry uses the pseudonym from when it was recorded
+	recorded := time.Now().Add(-48 * time.Hour)
+	recorder.FailNext(errors.New("copilot is down"))
+	err = ledger.Record(copilot.ConsentEntry{UserID: "user-1", ConsentValue: true, Timestamp: recorded.UnixMilli(), Source: "signup_form"})
+	assert.NotNil(t, err)
+	assert.Nil(t, ledger.Resync("user-1"))
+	records := recorder.Records()
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, policy.Pseudonymize("user-1", recorded), records[0].Consent.UserID)
+		assert.NotEqual(t, policy.Pseudonymize("user-1", time.Now()), records[0].Consent.UserID)
+	}
+}
+
+func TestPrivacySignalMiddlewareLedger(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	ledger, err := copilot.NewConsentLedger(copilot.NewMemoryConsentLedgerStore())
+	assert.Nil(t, err)
+	ledger.Client = recorder.Client
+	middleware := &copilot.PrivacySignalMiddleware{
+		UserID: func(r *http.Request) string {
+			return "user-1"
+		},
+		Ledger: ledger,
+	}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Sec-GPC", "1")
+	middleware.Wrap(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), request)
+
+	current, err := ledger.Current("user-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "gpc", current.Source)
+	recorder.AssertConsent(t, "user-1", false)
+}
@@ -0,0 +1,225 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ConsumableAggregatorConfig configures a ConsumableAggregator
+type ConsumableAggregatorConfig struct {
+	// Window is how often the summed usages are sent to Copilot. If 0, usages are only sent when Flush or Close is called.
+	Window time.Duration
+	// OnError is called with any errors from the background flushes. It defaults to logging the error.
+	OnError func(error)
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+}
+
+// ConsumableAggregator sums consumable usages per thing and consumable type over a window, sending a single
+// consumable usage event with the total quantity instead of one event per usage. Close should be called
+// on shutdown so that any remaining usages are sent.
+type ConsumableAggregator struct {
+	config ConsumableAggregatorConfig
+
+	lock    sync.Mutex
+	buckets map[consumableKey]*consumableBucket
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// consumableKey identifies the usages that are summed together
+type consumableKey struct {
+	thingID        string
+	consumableType string
+}
+
+// consumableBucket holds the summed usages for a key within the current window
+type consumableBucket struct {
+	userID   string
+	unit     string
+	quantity float64
+	count    int
+	first    int64
+	last     int64
+}
+
+// NewConsumableAggregator creates a new aggregator and, if a window is set, starts sending the summed usages in the background
+func NewConsumableAggregator(config ConsumableAggregatorConfig) *ConsumableAggregator {
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Printf("copilot consumable usage could not be sent: %v", err)
+		}
+	}
+	aggregator := &ConsumableAggregator{
+		config:  config,
+		buckets: map[consumableKey]*consumableBucket{},
+		done:    make(chan struct{}),
+	}
+	if config.Window > 0 {
+		aggregator.wg.Add(1)
+		go aggregator.run()
+	}
+	return aggregator
+}
+
+// Add records a usage of a consumable by the thing. The thingID and consumableType are required. Usages of the same
+// consumable type on a thing must use the same unit within a window. The userID is optional; the latest one seen
+// in the window is sent.
+func (aggregator *ConsumableAggregator) Add(thingID, userID, consumableType string, quantity float64, unit string, timestamp int64) error {
+	if thingID == "" {
+		return errors.New("thingID cannot be blank")
+	}
+	if consumableType == "" {
+		return errors.New("consumableType cannot be blank")
+	}
+	if quantity < 0 {
+		return errors.New("quantity cannot be negative")
+	}
+	timestamp, err := aggregator.config.Client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	if aggregator.closed {
+		return errors.New("the consumable aggregator has been closed")
+	}
+	key := consumableKey{
+		thingID:        thingID,
+		consumableType: consumableType,
+	}
+	bucket, found := aggregator.buckets[key]
+	if !found {
+		aggregator.buckets[key] = &consumableBucket{
+			userID:   userID,
+			unit:     unit,
+			quantity: quantity,
+			count:    1,
+			first:    timestamp,
+			last:     timestamp,
+		}
+		return nil
+	}
+	if bucket.unit != unit {
+		return fmt.Errorf("%s is being measured in %s, not %s", consumableType, bucket.unit, unit)
+	}
+	bucket.merge(&consumableBucket{
+		userID:   userID,
+		quantity: quantity,
+		count:    1,
+		first:    timestamp,
+		last:     timestamp,
+	})
+	return nil
+}
+
+// Flush sends the summed usages to Copilot immediately. Usages that fail to send are kept and retried on the next flush.
+// The first error encountered is returned.
+func (aggregator *ConsumableAggregator) Flush() error {
+	aggregator.lock.Lock()
+	buckets := aggregator.buckets
+	aggregator.buckets = map[consumableKey]*consumableBucket{}
+	aggregator.lock.Unlock()
+
+	var firstErr error
+	for key, bucket := range buckets {
+		err := bucket.send(aggregator.config.Client, key)
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !aggregator.restore(key, bucket) {
+			aggregator.config.OnError(fmt.Errorf("dropping %v %s of %s for %s since the unit has changed", bucket.quantity, bucket.unit, key.consumableType, key.thingID))
+		}
+	}
+	return firstErr
+}
+
+// Close stops the background flushes and sends any remaining usages. After Close, Add returns an error.
+func (aggregator *ConsumableAggregator) Close() error {
+	aggregator.lock.Lock()
+	if aggregator.closed {
+		aggregator.lock.Unlock()
+		return nil
+	}
+	aggregator.closed = true
+	aggregator.lock.Unlock()
+
+	close(aggregator.done)
+	aggregator.wg.Wait()
+	return aggregator.Flush()
+}
+
+// run flushes the usages every window until the aggregator is closed
+func (aggregator *ConsumableAggregator) run() {
+	defer aggregator.wg.Done()
+	ticker := time.NewTicker(aggregator.config.Window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-aggregator.done:
+			return
+		case <-ticker.C:
+			if err := aggregator.Flush(); err != nil {
+				aggregator.config.OnError(err)
+			}
+		}
+	}
+}
+
+// restore puts a bucket that failed to send back so it is included in the next flush. It returns false if
+// the bucket could not be restored because the unit has changed since.
+func (aggregator *ConsumableAggregator) restore(key consumableKey, bucket *consumableBucket) bool {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	existing, found := aggregator.buckets[key]
+	if !found {
+		aggregator.buckets[key] = bucket
+		return true
+	}
+	if existing.unit != bucket.unit {
+		return false
+	}
+	// the existing usages are newer, so merge the failed bucket into them
+	bucket.merge(existing)
+	aggregator.buckets[key] = bucket
+	return true
+}
+
+// merge adds the other bucket's usages into this bucket
+func (bucket *consumableBucket) merge(other *consumableBucket) {
+	bucket.quantity += other.quantity
+	bucket.count += other.count
+	if other.first < bucket.first {
+		bucket.first = other.first
+	}
+	if other.last >= bucket.last {
+		bucket.last = other.last
+		if other.userID != "" {
+			bucket.userID = other.userID
+		}
+	}
+}
+
+// send sends the summed usages as a single consumable usage event
+func (bucket *consumableBucket) send(client *Client, key consumableKey) error {
+	additional := map[string]interface{}{
+		"quantity":     bucket.quantity,
+		"usage_count":  bucket.count,
+		"window_start": bucket.first,
+		"window_end":   bucket.last,
+	}
+	if bucket.unit != "" {
+		additional["unit"] = bucket.unit
+	}
+	eventID := uniqueEventID(EventTypeThingConsumableUsage, bucket.last, key.thingID, key.consumableType)
+	return client.thingConsumableUsageEvent(key.thingID, bucket.userID, key.consumableType, bucket.last, eventID, additional)
+}
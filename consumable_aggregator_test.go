@@ -0,0 +1,156 @@
+package copilot_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumableAggregator(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	timestamp := time.Now().UnixMilli()
+
+	// make sure the required fields are checked
+	err := recorder.ThingConsumableUsageQuantity("thing-1", "user-1", "", 25, "g", timestamp, "")
+	assert.NotNil(t, err)
+
+	aggregator := copilot.NewConsumableAggregator(copilot.ConsumableAggregatorConfig{
+		Client: recorder.Client,
+	})
+	err = aggregator.Add("", "user-1", "food", 25, "g", timestamp)
+	assert.NotNil(t, err)
+	err = aggregator.Add("thing-1", "user-1", "", 25, "g", timestamp)
+	assert.NotNil(t, err)
+	err = aggregator.Add("thing-1", "user-1", "food", -1, "g", timestamp)
+	assert.NotNil(t, err)
+
+	// usages in the same window are summed, with the latest user
+	err = aggregator.Add("thing-1", "user-1", "food", 25, "g", timestamp)
+	assert.Nil(t, err)
+	err = aggregator.Add("thing-1", "user-2", "food", 10, "g", timestamp+1000)
+	assert.Nil(t, err)
+	err = aggregator.Add("thing-1", "user-1", "food", 5, "g", timestamp+500)
+	assert.Nil(t, err)
+	// units must stay consistent within the window
+	err = aggregator.Add("thing-1", "user-1", "food", 1, "cups", timestamp+2000)
+	assert.NotNil(t, err)
+	// other consumable types are summed separately
+	err = aggregator.Add("thing-1", "user-1", "water", 150, "ml", timestamp)
+	assert.Nil(t, err)
+	assert.Empty(t, recorder.Records())
+
+	assert.Nil(t, aggregator.Flush())
+	assert.Len(t, recorder.Events(), 2)
+	recorder.AssertEmitted(t, copilot.EventTypeThingConsumableUsage, "user-2", map[string]interface{}{
+		"thing_id":        "thing-1",
+		"consumable_type": "food",
+		"quantity":        40,
+		"unit":            "g",
+		"usage_count":     3,
+		"window_start":    timestamp,
+		"window_end":      timestamp + 1000,
+	})
+	recorder.AssertEmitted(t, copilot.EventTypeThingConsumableUsage, "user-1", map[string]interface{}{
+		"thing_id":        "thing-1",
+		"consumable_type": "water",
+		"quantity":        150,
+		"unit":            "ml",
+		"usage_count":     1,
+		"window_start":    timestamp,
+		"window_end":      timestamp,
+	})
+
+	// the next window starts empty, so a new unit is accepted, and Close sends it
+	recorder.Reset()
+	err = aggregator.Add("thing-1", "user-1", "food", 1, "cups", timestamp+3000)
+	assert.Nil(t, err)
+	err = aggregator.Add("thing-1", "user-1", "food", 2, "cups", timestamp+4000)
+	assert.Nil(t, err)
+	err = aggregator.Close()
+	assert.Nil(t, err)
+	assert.Len(t, recorder.Events(), 1)
+	recorder.AssertEmitted(t, copilot.EventTypeThingConsumableUsage, "user-1", map[string]interface{}{
+		"quantity":     3,
+		"unit":         "cups",
+		"usage_count":  2,
+		"window_start": timestamp + 3000,
+		"window_end":   timestamp + 4000,
+	})
+	// once closed, no more usages are accepted
+	err = aggregator.Add("thing-1", "user-1", "food", 10, "g", timestamp+5000)
+	assert.NotNil(t, err)
+}
+
+func TestConsumableAggregatorWindow(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	timestamp := time.Now().UnixMilli()
+	aggregator := copilot.NewConsumableAggregator(copilot.ConsumableAggregatorConfig{
+		Window:  10 * time.Millisecond,
+		OnError: func(error) {},
+		Client:  recorder.Client,
+	})
+	defer aggregator.Close()
+
+	// the usages are sent in the background once the window passes
+	assert.Nil(t, aggregator.Add("thing-1", "user-1", "food", 25, "g", timestamp))
+	assert.Nil(t, aggregator.Add("thing-1", "user-1", "food", 15, "g", timestamp+1000))
+	_, found := recorder.WaitFor(copilot.EventTypeThingConsumableUsage, "user-1", time.Second)
+	assert.True(t, found)
+	recorder.AssertEmitted(t, copilot.EventTypeThingConsumableUsage, "user-1", map[string]interface{}{
+		"quantity":    40,
+		"usage_count": 2,
+	})
+
+	// a failed flush keeps the usages for the next window
+	recorder.Reset()
+	recorder.FailOn(copilot.EventTypeThingConsumableUsage, fmt.Errorf("copilot is down"), 1)
+	assert.Nil(t, aggregator.Add("thing-1", "user-2", "food", 5, "g", timestamp+2000))
+	_, found = recorder.WaitFor(copilot.EventTypeThingConsumableUsage, "user-2", time.Second)
+	assert.True(t, found)
+	recorder.AssertEmitted(t, copilot.EventTypeThingConsumableUsage, "user-2", map[string]interface{}{
+		"quantity":     5,
+		"usage_count":  1,
+		"window_start": timestamp + 2000,
+	})
+	assert.Len(t, recorder.Events(), 1)
+}
+
+func TestConsumableAggregatorEventIDs(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	timestamp := time.Now().UnixMilli()
+	aggregator := copilot.NewConsumableAggregator(copilot.ConsumableAggregatorConfig{
+		Client: recorder.Client,
+	})
+	defer aggregator.Close()
+
+	// every consumable and window of a thing with a long ID keeps a distinct event ID
+	thingID := "3f2b8c1e-9a4d-4c1b-8e2f-123456789abc"
+	assert.Nil(t, aggregator.Add(thingID, "user-1", "food", 25, "g", timestamp))
+	assert.Nil(t, aggregator.Add(thingID, "user-1", "water", 150, "ml", timestamp))
+	assert.Nil(t, aggregator.Flush())
+	assert.Nil(t, aggregator.Add(thingID, "user-1", "food", 10, "g", timestamp+1000))
+	assert.Nil(t, aggregator.Flush())
+	events := recorder.Events()
+	assert.Len(t, events, 3)
+	ids := map[string]bool{}
+	for _, event := range events {
+		assert.LessOrEqual(t, len(event.EventID), 50)
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, 3)
+}
+
+func TestConsumableUsageQuantity(t *testing.T) {
+	if !copilot.IsSetUp() {
+		t.SkipNow()
+	}
+	userID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	thingID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	err := copilot.ThingConsumableUsageQuantity(thingID, userID, "water", 150, "ml", time.Now().UnixMilli(), "")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,331 @@
+// Package copilottest provides a Recorder that implements copilot.Emitter so that applications can
+// assert on the events they send to Copilot without a Copilot instance or a network server.
+package copilottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+)
+
+// ConsentEventType is the event type used for consent updates when injecting failures
+const ConsentEventType = "consent"
+
+// TestingT is the subset of *testing.T used by the assertion helpers
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Recorder is a copilot.Emitter that records every event and consent update instead of sending it. It embeds a
+// dry run copilot.Client, so every call is validated and built exactly as it would be sent. The embedded Client
+// can also be passed to the trackers in the copilot package.
+type Recorder struct {
+	*copilot.Client
+
+	lock     sync.Mutex
+	records  []copilot.DryRunRecord
+	failures []*failure
+	rejects  map[string]string
+	changed  chan struct{}
+}
+
+// failure is an injected error for requests that include an event of the type
+type failure struct {
+	eventType string
+	err       error
+	// remaining is the number of times left to fail, or -1 to always fail
+	remaining int
+}
+
+// NewRecorder creates an empty recorder. Any options, such as copilot.WithClock or copilot.WithPrivacyPolicy,
+// are applied to the embedded client.
+func NewRecorder(options ...copilot.Option) *Recorder {
+	recorder := &Recorder{
+		rejects: map[string]string{},
+		changed: make(chan struct{}),
+	}
+	options = append(options, copilot.WithDryRun(recorder), copilot.WithDryRunValidator(recorder.validate))
+	client, err := copilot.NewClient("", "", "", "", options...)
+	if err != nil {
+		// this can only happen if the dry run option is removed
+		panic(err)
+	}
+	recorder.Client = client
+	return recorder
+}
+
+// Write records the request unless a failure has been injected for it. It implements copilot.DryRunSink.
+func (recorder *Recorder) Write(record copilot.DryRunRecord) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if err := recorder.injectedFailure(record); err != nil {
+		return err
+	}
+	recorder.records = append(recorder.records, record)
+	close(recorder.changed)
+	recorder.changed = make(chan struct{})
+	return nil
+}
+
+// FailNext makes the next request fail with the error, regardless of its type
+func (recorder *Recorder) FailNext(err error) {
+	recorder.FailOn("", err, 1)
+}
+
+// FailOn makes the next times requests with an event of the type fail with the error. Use ConsentEventType for
+// consent updates, a blank type for any request, and a times of -1 to fail until ClearFailures is called.
+func (recorder *Recorder) FailOn(eventType string, err error, times int) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.failures = append(recorder.failures, &failure{
+		eventType: eventType,
+		err:       err,
+		remaining: times,
+	})
+}
+
+// RejectOn simulates Copilot rejecting every event of the type, which returns a *copilot.InvalidEventError with
+// the message to the caller. Rejected events are still recorded, as they were sent.
+func (recorder *Recorder) RejectOn(eventType string, message string) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.rejects[eventType] = message
+}
+
+// ClearFailures removes every injected failure and rejection
+func (recorder *Recorder) ClearFailures() {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.failures = nil
+	recorder.rejects = map[string]string{}
+}
+
+// Reset removes every recorded request. Injected failures are kept.
+func (recorder *Recorder) Reset() {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.records = nil
+}
+
+// Records returns every recorded request, in order
+func (recorder *Recorder) Records() []copilot.DryRunRecord {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	records := make([]copilot.DryRunRecord, len(recorder.records))
+	copy(records, recorder.records)
+	return records
+}
+
+// Events returns every recorded event, in order
+func (recorder *Recorder) Events() []copilot.Event {
+	events := []copilot.Event{}
+	for _, record := range recorder.Records() {
+		events = append(events, record.Events...)
+	}
+	return events
+}
+
+// EventsOfType returns every recorded event of the type, in order
+func (recorder *Recorder) EventsOfType(eventType string) []copilot.Event {
+	events := []copilot.Event{}
+	for _, event := range recorder.Events() {
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// UserEvents returns every recorded event of the type with the user_id in its payload. A blank type matches any type.
+func (recorder *Recorder) UserEvents(eventType string, userID string) []copilot.Event {
+	return recorder.matching(eventType, "user_id", userID)
+}
+
+// ThingEvents returns every recorded event of the type with the thing_id in its payload. A blank type matches any type.
+func (recorder *Recorder) ThingEvents(eventType string, thingID string) []copilot.Event {
+	return recorder.matching(eventType, "thing_id", thingID)
+}
+
+// ConsentUpdates returns every recorded consent update, in order
+func (recorder *Recorder) ConsentUpdates() []copilot.ConsentRequest {
+	updates := []copilot.ConsentRequest{}
+	for _, record := range recorder.Records() {
+		if record.Consent != nil {
+			updates = append(updates, *record.Consent)
+		}
+	}
+	return updates
+}
+
+// WaitFor waits up to the timeout for an event of the type for the user, which is useful when events are sent in
+// the background. A blank userID matches any user. It returns the first matching event.
+func (recorder *Recorder) WaitFor(eventType string, userID string, timeout time.Duration) (copilot.Event, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		recorder.lock.Lock()
+		changed := recorder.changed
+		recorder.lock.Unlock()
+
+		var events []copilot.Event
+		if userID == "" {
+			events = recorder.EventsOfType(eventType)
+		} else {
+			events = recorder.UserEvents(eventType, userID)
+		}
+		if len(events) > 0 {
+			return events[0], true
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return copilot.Event{}, false
+		}
+	}
+}
+
+// AssertEmitted checks that an event of the type was recorded for the user and that its payload contains every key
+// in expected with an equal value. Other keys on the payload are ignored. It returns true if a match was found.
+func (recorder *Recorder) AssertEmitted(t TestingT, eventType string, userID string, expected map[string]interface{}) bool {
+	t.Helper()
+	events := recorder.UserEvents(eventType, userID)
+	if len(events) == 0 {
+		t.Errorf("expected a %s event for user %s, but none were recorded", eventType, userID)
+		return false
+	}
+	want, err := normalize(expected)
+	if err != nil {
+		t.Errorf("the expected payload could not be normalized: %v", err)
+		return false
+	}
+	var mismatch string
+	for _, event := range events {
+		mismatch = payloadMismatch(event, want)
+		if mismatch == "" {
+			return true
+		}
+	}
+	t.Errorf("no %s event for user %s matched the expected payload: %s", eventType, userID, mismatch)
+	return false
+}
+
+// AssertNotEmitted checks that no event of the type was recorded for the user
+func (recorder *Recorder) AssertNotEmitted(t TestingT, eventType string, userID string) bool {
+	t.Helper()
+	events := recorder.UserEvents(eventType, userID)
+	if len(events) > 0 {
+		t.Errorf("expected no %s events for user %s, but %d were recorded", eventType, userID, len(events))
+		return false
+	}
+	return true
+}
+
+// AssertConsent checks that the most recent consent update for the user has the value
+func (recorder *Recorder) AssertConsent(t TestingT, userID string, consentValue bool) bool {
+	t.Helper()
+	updates := recorder.ConsentUpdates()
+	for i := len(updates) - 1; i >= 0; i-- {
+		if updates[i].UserID != userID {
+			continue
+		}
+		if updates[i].ConsentValue != consentValue {
+			t.Errorf("expected the consent for user %s to be %t, but it was %t", userID, consentValue, updates[i].ConsentValue)
+			return false
+		}
+		return true
+	}
+	t.Errorf("expected a consent update for user %s, but none were recorded", userID)
+	return false
+}
+
+// Payload decodes the payload of a recorded event into a typed value, such as copilot.UserEventPayload
+func Payload[T any](event copilot.Event) (T, error) {
+	var payload T
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return payload, err
+	}
+	err = json.Unmarshal(data, &payload)
+	return payload, err
+}
+
+// injectedFailure returns the error for the first failure that matches the record; the lock must be held
+func (recorder *Recorder) injectedFailure(record copilot.DryRunRecord) error {
+	types := []string{}
+	for _, event := range record.Events {
+		types = append(types, event.Type)
+	}
+	if record.Consent != nil {
+		types = append(types, ConsentEventType)
+	}
+	for i, failure := range recorder.failures {
+		matched := failure.eventType == ""
+		for _, eventType := range types {
+			matched = matched || eventType == failure.eventType
+		}
+		if !matched {
+			continue
+		}
+		if failure.remaining > 0 {
+			failure.remaining--
+			if failure.remaining == 0 {
+				recorder.failures = append(recorder.failures[:i], recorder.failures[i+1:]...)
+			}
+		}
+		return failure.err
+	}
+	return nil
+}
+
+// validate simulates rejections; it is used as the client's dry run validator
+func (recorder *Recorder) validate(event copilot.Event) string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return recorder.rejects[event.Type]
+}
+
+// matching returns the events of the type whose payload has the key set to the value
+func (recorder *Recorder) matching(eventType string, key string, value string) []copilot.Event {
+	events := []copilot.Event{}
+	for _, event := range recorder.Events() {
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		payload, ok := event.Payload.(map[string]interface{})
+		if ok && payload[key] == value {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// normalize round trips the value through JSON so it can be compared with a recorded payload
+func normalize(value map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	normalized := map[string]interface{}{}
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
+
+// payloadMismatch describes the first expected key that does not match the payload, or returns blank if all match
+func payloadMismatch(event copilot.Event, expected map[string]interface{}) string {
+	payload, _ := event.Payload.(map[string]interface{})
+	for key, want := range expected {
+		got, found := payload[key]
+		if !found {
+			return fmt.Sprintf("%s is missing", key)
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Sprintf("%s is %v, expected %v", key, got, want)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package copilottest_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeT captures assertion failures so the helpers can be tested
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	var emitter copilot.Emitter = recorder
+
+	err := emitter.UserCreated("user-1", 1600000000000, "", &copilot.UserEventPayload{
+		Email: copilot.String("user@example.com"),
+	})
+	assert.Nil(t, err)
+	err = emitter.ThingAssociated("thing-1", "user-1", 1600000000000, "")
+	assert.Nil(t, err)
+	err = emitter.UpdateUserConsent("user-1", true)
+	assert.Nil(t, err)
+
+	assert.Len(t, recorder.Events(), 2)
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeUserCreated), 1)
+	assert.Len(t, recorder.UserEvents("", "user-1"), 2)
+	assert.Len(t, recorder.ThingEvents(copilot.EventTypeThingAssociated, "thing-1"), 1)
+	assert.Len(t, recorder.ConsentUpdates(), 1)
+
+	payload, err := copilottest.Payload[copilot.UserEventPayload](recorder.EventsOfType(copilot.EventTypeUserCreated)[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "user@example.com", *payload.Email)
+
+	assert.True(t, recorder.AssertEmitted(t, copilot.EventTypeUserCreated, "user-1", map[string]interface{}{
+		"email": "user@example.com",
+	}))
+	assert.True(t, recorder.AssertNotEmitted(t, copilot.EventTypeUserDeleted, "user-1"))
+	assert.True(t, recorder.AssertConsent(t, "user-1", true))
+
+	// failed assertions are reported
+	fake := &fakeT{}
+	assert.False(t, recorder.AssertEmitted(fake, copilot.EventTypeUserCreated, "user-1", map[string]interface{}{
+		"email": "other@example.com",
+	}))
+	assert.False(t, recorder.AssertEmitted(fake, copilot.EventTypeUserDeleted, "user-1", nil))
+	assert.False(t, recorder.AssertNotEmitted(fake, copilot.EventTypeUserCreated, "user-1"))
+	assert.False(t, recorder.AssertConsent(fake, "user-1", false))
+	assert.False(t, recorder.AssertConsent(fake, "user-2", true))
+	assert.Len(t, fake.errors, 5)
+
+	recorder.Reset()
+	assert.Len(t, recorder.Events(), 0)
+}
+
+func TestRecorderFailures(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	injected := errors.New("copilot is down")
+
+	// the next request fails, regardless of type
+	recorder.FailNext(injected)
+	assert.Equal(t, injected, recorder.UserDeleted("user-1", 0, ""))
+	assert.Nil(t, recorder.UserDeleted("user-1", 0, ""))
+
+	// consent failures can be targeted
+	recorder.FailOn(copilottest.ConsentEventType, injected, -1)
+	assert.Equal(t, injected, recorder.UpdateUserConsent("user-1", false))
+	assert.Equal(t, injected, recorder.UpdateUserConsent("user-1", false))
+	assert.Nil(t, recorder.UserDeleted("user-1", 0, ""))
+
+	// rejected events are returned as invalid but still recorded
+	recorder.RejectOn(copilot.EventTypeThingConnected, "thing_id is unknown")
+	err := recorder.ThingConnected("thing-1", "", 0, "")
+	assert.NotNil(t, err)
+	invalid, ok := err.(*copilot.InvalidEventError)
+	assert.True(t, ok)
+	assert.Equal(t, "thing_id is unknown", invalid.EventError)
+	assert.Len(t, recorder.ThingEvents(copilot.EventTypeThingConnected, "thing-1"), 1)
+
+	recorder.ClearFailures()
+	assert.Nil(t, recorder.UpdateUserConsent("user-1", false))
+	assert.Nil(t, recorder.ThingConnected("thing-1", "", 0, ""))
+	assert.Len(t, recorder.ConsentUpdates(), 1)
+}
+
+func TestRecorderWaitFor(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+
+	_, found := recorder.WaitFor(copilot.EventTypeUserDeleted, "user-1", 10*time.Millisecond)
+	assert.False(t, found)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		recorder.UserDeleted("user-1", 0, "")
+	}()
+	event, found := recorder.WaitFor(copilot.EventTypeUserDeleted, "user-1", time.Second)
+	assert.True(t, found)
+	assert.Equal(t, copilot.EventTypeUserDeleted, event.Type)
+}
@@ -0,0 +1,193 @@
+package copilot
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Credentials are the client ID and secret used to authenticate with Copilot
+type Credentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// CredentialProvider supplies the credentials for each request, which allows secrets to be rotated without
+// restarting. Credentials is called for every request, so it should be cheap. Refresh is called once when
+// Copilot responds with a 401, and the request is retried only if the credentials changed.
+type CredentialProvider interface {
+	Credentials() (Credentials, error)
+	Refresh() error
+}
+
+// WithCredentialProvider uses the provider for the credentials of every request instead of the client ID and
+// secret passed to Setup, which can then be blank
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(config *configStruct) {
+		config.CredentialProvider = provider
+	}
+}
+
+// StaticCredentials always provides the same credentials. It is used when no provider is configured.
+func StaticCredentials(clientID string, clientSecret string) CredentialProvider {
+	return &staticCredentials{
+		credentials: Credentials{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+		},
+	}
+}
+
+type staticCredentials struct {
+	credentials Credentials
+}
+
+func (provider *staticCredentials) Credentials() (Credentials, error) {
+	return provider.credentials, nil
+}
+
+func (provider *staticCredentials) Refresh() error {
+	return nil
+}
+
+// EnvCredentials reads the credentials from the environment variables on every request. Blank keys default to
+// COPILOT_CLIENT_ID and COPILOT_CLIENT_SECRET.
+func EnvCredentials(clientIDKey string, clientSecretKey string) CredentialProvider {
+	if clientIDKey == "" {
+		clientIDKey = "COPILOT_CLIENT_ID"
+	}
+	if clientSecretKey == "" {
+		clientSecretKey = "COPILOT_CLIENT_SECRET"
+	}
+	return &envCredentials{
+		clientIDKey:     clientIDKey,
+		clientSecretKey: clientSecretKey,
+	}
+}
+
+type envCredentials struct {
+	clientIDKey     string
+	clientSecretKey string
+}
+
+func (provider *envCredentials) Credentials() (Credentials, error) {
+	credentials := Credentials{
+		ClientID:     os.Getenv(provider.clientIDKey),
+		ClientSecret: os.Getenv(provider.clientSecretKey),
+	}
+	if credentials.ClientID == "" || credentials.ClientSecret == "" {
+		return credentials, errors.New("copilot credentials are not set in the environment")
+	}
+	return credentials, nil
+}
+
+func (provider *envCredentials) Refresh() error {
+	// the environment is read on every request
+	return nil
+}
+
+// FileCredentialProvider reads the credentials from a JSON file with client_id and client_secret keys, such as
+// a mounted secret, and reloads them when the file changes
+type FileCredentialProvider struct {
+	path string
+
+	lock        sync.RWMutex
+	credentials Credentials
+	modified    time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// FileCredentials creates a provider for the file, checking it for changes on the interval. An interval of 0
+// only reloads the file when Copilot responds with a 401. Call Stop to stop checking the file.
+func FileCredentials(path string, interval time.Duration) (*FileCredentialProvider, error) {
+	if path == "" {
+		return nil, errors.New("path cannot be blank")
+	}
+	provider := &FileCredentialProvider{
+		path: path,
+	}
+	if err := provider.Refresh(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		provider.done = make(chan struct{})
+		provider.wg.Add(1)
+		go provider.watch(interval)
+	}
+	return provider, nil
+}
+
+// Credentials returns the credentials most recently read from the file
+func (provider *FileCredentialProvider) Credentials() (Credentials, error) {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+	return provider.credentials, nil
+}
+
+// Refresh reads the file again
+func (provider *FileCredentialProvider) Refresh() error {
+	info, err := os.Stat(provider.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(provider.path)
+	if err != nil {
+		return err
+	}
+	credentials := Credentials{}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return err
+	}
+	if credentials.ClientID == "" || credentials.ClientSecret == "" {
+		return errors.New("the credentials file must contain a client_id and client_secret")
+	}
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	provider.credentials = credentials
+	provider.modified = info.ModTime()
+	return nil
+}
+
+// Stop stops checking the file for changes
+func (provider *FileCredentialProvider) Stop() {
+	if provider.done != nil {
+		close(provider.done)
+		provider.wg.Wait()
+		provider.done = nil
+	}
+}
+
+// watch reloads the file whenever its modification time changes
+func (provider *FileCredentialProvider) watch(interval time.Duration) {
+	defer provider.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-provider.done:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(provider.path)
+			if err != nil {
+				log.Printf("copilot credentials file could not be checked: %v", err)
+				continue
+			}
+			provider.lock.RLock()
+			modified := provider.modified
+			provider.lock.RUnlock()
+			if info.ModTime().Equal(modified) {
+				continue
+			}
+			if err := provider.Refresh(); err != nil {
+				// keep the previous credentials; the file may be in the middle of being written
+				log.Printf("copilot credentials file could not be reloaded: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package copilot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCredentials(t *testing.T, path string, secret string) {
+	err := os.WriteFile(path, []byte(`{"client_id":"id","client_secret":"`+secret+`"}`), 0600)
+	assert.Nil(t, err)
+}
+
+func TestCredentialRotation(t *testing.T) {
+	var unauthorized int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "id" || secret != "new-secret" {
+			atomic.AddInt32(&unauthorized, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"reason":"unauthorized","error_message":"invalid credentials"}`))
+			return
+		}
+		w.Write([]byte(`{"invalid_events":[]}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	_, err := copilot.FileCredentials(path, 0)
+	assert.NotNil(t, err)
+	writeCredentials(t, path, "old-secret")
+	provider, err := copilot.FileCredentials(path, 0)
+	assert.Nil(t, err)
+	defer provider.Stop()
+
+	// credentials are not needed in Setup with a provider
+	client, err := copilot.NewClient("", "", server.URL, "", copilot.WithCredentialProvider(provider))
+	assert.Nil(t, err)
+
+	// the old secret is refreshed after the 401, but since it did not change, the request is not retried
+	err = client.UserDeleted("user-1", 0, "")
+	_, ok := err.(*copilot.EventResponseError)
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&unauthorized))
+
+	// once the secret is rotated, the refresh after the 401 picks it up
+	writeCredentials(t, path, "new-secret")
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&unauthorized))
+	credentials, err := provider.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "new-secret", credentials.ClientSecret)
+}
+
+func TestStaticCredentialsAreNotRetried(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"reason":"unauthorized","error_message":"invalid credentials"}`))
+	}))
+	defer server.Close()
+
+	client, err := copilot.NewClient("id", "secret", server.URL, server.URL)
+	assert.Nil(t, err)
+	_, ok := client.UserDeleted("user-1", 0, "").(*copilot.EventResponseError)
+	assert.True(t, ok)
+	assert.NotNil(t, client.UpdateUserConsent("user-1", true))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestCredentialProviders(t *testing.T) {
+	credentials, err := copilot.StaticCredentials("id", "secret").Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", credentials.ClientSecret)
+
+	provider := copilot.EnvCredentials("TEST_COPILOT_ID", "TEST_COPILOT_SECRET")
+	_, err = provider.Credentials()
+	assert.NotNil(t, err)
+	t.Setenv("TEST_COPILOT_ID", "id")
+	t.Setenv("TEST_COPILOT_SECRET", "secret")
+	credentials, err = provider.Credentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "id", credentials.ClientID)
+
+	// the file is watched for changes
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	writeCredentials(t, path, "first")
+	fileProvider, err := copilot.FileCredentials(path, 5*time.Millisecond)
+	assert.Nil(t, err)
+	defer fileProvider.Stop()
+	// make sure the modification time changes on file systems with coarse times
+	time.Sleep(10 * time.Millisecond)
+	writeCredentials(t, path, "second")
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	assert.Eventually(t, func() bool {
+		credentials, _ := fileProvider.Credentials()
+		return credentials.ClientSecret == "second"
+	}, time.Second, 5*time.Millisecond)
+}
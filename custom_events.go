@@ -13,8 +13,14 @@ type CustomEventPayload map[string]interface{}
 
 // CustomEvent represents a single custom event sent to copilot. It must have a set subtype. In the payload
 // either a user_id or thing_id string must be provided. Both can be provided. All other keys on the
-// payload will be sent as is.
+// payload will be sent as is. When strict mode is enabled with SetStrictCustomEvents, the subtype and keys must
+// match a payload registered with RegisterCustomEvent.
 func CustomEvent(eventSubtype string, timestamp int64, eventID string, payload CustomEventPayload) error {
+	return DefaultClient().CustomEvent(eventSubtype, timestamp, eventID, payload)
+}
+
+// CustomEvent is the same as the package level CustomEvent, using the client's configuration
+func (client *Client) CustomEvent(eventSubtype string, timestamp int64, eventID string, payload CustomEventPayload) error {
 	if eventSubtype == "" {
 		return errors.New("you must provide a subtype")
 	}
@@ -28,6 +34,14 @@ func CustomEvent(eventSubtype string, timestamp int64, eventID string, payload C
 	if !foundUser && !foundThing {
 		return errors.New("either a user_id or a thing_id must be included in the payload")
 	}
+	if err := checkStrictCustomEvent(eventSubtype, payload); err != nil {
+		return err
+	}
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeCustomEvent, eventSubtype, timestamp)
 	}
@@ -39,5 +53,5 @@ func CustomEvent(eventSubtype string, timestamp int64, eventID string, payload C
 		Payload:   payload,
 	}
 
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
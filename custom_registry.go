@@ -0,0 +1,238 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// customEventField is a single exported field on a registered custom event struct
+type customEventField struct {
+	index     int
+	key       string
+	required  bool
+	omitEmpty bool
+}
+
+// customEventSchema is the result of reflecting over a registered custom event struct
+type customEventSchema struct {
+	subtype string
+	typ     reflect.Type
+	fields  []customEventField
+	keys    map[string]bool
+}
+
+// customEventRegistry holds all of the registered custom event subtypes. It is global since the Go types
+// being registered are global as well.
+var customEventRegistry = struct {
+	sync.RWMutex
+	bySubtype map[string]*customEventSchema
+	byType    map[reflect.Type]*customEventSchema
+	strict    bool
+}{
+	bySubtype: map[string]*customEventSchema{},
+	byType:    map[reflect.Type]*customEventSchema{},
+}
+
+// RegisterCustomEvent registers a struct type as the payload for a custom event subtype. Each exported field is
+// sent using the key from its `copilot` struct tag, falling back to the `json` tag and then the field name. The
+// tag options `required` and `omitempty` are supported, and a tag of "-" skips the field, for example:
+//
+//	type DoorOpened struct {
+//		UserID string `copilot:"user_id,required"`
+//		Door   string `copilot:"door,omitempty"`
+//	}
+//
+// The struct must declare a user_id or thing_id key, as Copilot requires one of them on every custom event.
+func RegisterCustomEvent[T any](eventSubtype string) error {
+	if eventSubtype == "" {
+		return errors.New("you must provide a subtype")
+	}
+	var zero T
+	typ := reflect.TypeOf(zero)
+	if typ == nil {
+		return errors.New("custom event payloads must be structs")
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("custom event payloads must be structs, received %s", typ.Kind())
+	}
+
+	schema, err := buildCustomEventSchema(eventSubtype, typ)
+	if err != nil {
+		return err
+	}
+
+	customEventRegistry.Lock()
+	defer customEventRegistry.Unlock()
+	if _, found := customEventRegistry.bySubtype[eventSubtype]; found {
+		return fmt.Errorf("custom event subtype %s is already registered", eventSubtype)
+	}
+	if existing, found := customEventRegistry.byType[typ]; found {
+		return fmt.Errorf("%s is already registered for subtype %s", typ, existing.subtype)
+	}
+	customEventRegistry.bySubtype[eventSubtype] = schema
+	customEventRegistry.byType[typ] = schema
+	return nil
+}
+
+// SetStrictCustomEvents toggles strict mode for custom events. In strict mode, CustomEvent rejects subtypes that
+// have not been registered with RegisterCustomEvent as well as any payload keys the registered struct does not declare.
+func SetStrictCustomEvents(strict bool) {
+	customEventRegistry.Lock()
+	customEventRegistry.strict = strict
+	customEventRegistry.Unlock()
+}
+
+// SendCustom sends a custom event using a payload struct previously registered with RegisterCustomEvent. Required
+// fields must be non-zero, and either the user_id or thing_id key must be set.
+func SendCustom[T any](timestamp int64, eventID string, payload T) error {
+	return SendCustomWith(DefaultClient(), timestamp, eventID, payload)
+}
+
+// SendCustomWith is the same as SendCustom, but sends the event through the emitter, such as a Client or
+// a test recorder
+func SendCustomWith[T any](emitter Emitter, timestamp int64, eventID string, payload T) error {
+	value := reflect.ValueOf(payload)
+	if !value.IsValid() {
+		return errors.New("payload is required")
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return errors.New("payload is required")
+		}
+		value = value.Elem()
+	}
+
+	customEventRegistry.RLock()
+	schema, found := customEventRegistry.byType[value.Type()]
+	customEventRegistry.RUnlock()
+	if !found {
+		return fmt.Errorf("%s has not been registered as a custom event", value.Type())
+	}
+
+	data, err := schema.marshal(value)
+	if err != nil {
+		return err
+	}
+	return emitter.CustomEvent(schema.subtype, timestamp, eventID, data)
+}
+
+// buildCustomEventSchema reflects over the struct and parses the tags on each field
+func buildCustomEventSchema(eventSubtype string, typ reflect.Type) (*customEventSchema, error) {
+	schema := &customEventSchema{
+		subtype: eventSubtype,
+		typ:     typ,
+		keys:    map[string]bool{},
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		structField := typ.Field(i)
+		if structField.PkgPath != "" {
+			// unexported
+			continue
+		}
+		tag, found := structField.Tag.Lookup("copilot")
+		if !found {
+			tag = structField.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		field := customEventField{
+			index: i,
+			key:   parts[0],
+		}
+		if field.key == "" {
+			field.key = structField.Name
+		}
+		for _, option := range parts[1:] {
+			switch option {
+			case "required":
+				field.required = true
+			case "omitempty":
+				field.omitEmpty = true
+			case "":
+			default:
+				return nil, fmt.Errorf("unknown option %s on field %s", option, structField.Name)
+			}
+		}
+		if field.key == "subtype" {
+			return nil, errors.New("the subtype key is reserved and cannot be used as a field")
+		}
+		if schema.keys[field.key] {
+			return nil, fmt.Errorf("the key %s is declared more than once", field.key)
+		}
+		schema.keys[field.key] = true
+		schema.fields = append(schema.fields, field)
+	}
+	if !schema.keys["user_id"] && !schema.keys["thing_id"] {
+		return nil, errors.New("either a user_id or a thing_id key must be declared on the payload")
+	}
+	return schema, nil
+}
+
+// marshal converts the struct value into the payload sent to Copilot, enforcing required fields
+func (schema *customEventSchema) marshal(value reflect.Value) (CustomEventPayload, error) {
+	payload := CustomEventPayload{}
+	for _, field := range schema.fields {
+		fieldValue := value.Field(field.index)
+		empty := fieldValue.IsZero()
+		if fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil() {
+			fieldValue = fieldValue.Elem()
+			empty = fieldValue.IsZero()
+		}
+		if empty && field.required {
+			return nil, fmt.Errorf("%s is required for subtype %s", field.key, schema.subtype)
+		}
+		if fieldValue.Kind() == reflect.Ptr || (empty && field.omitEmpty) {
+			continue
+		}
+		payload[field.key] = fieldValue.Interface()
+	}
+	if !customIDPresent(payload, "user_id") && !customIDPresent(payload, "thing_id") {
+		return nil, errors.New("either a user_id or a thing_id must be included in the payload")
+	}
+	return payload, nil
+}
+
+// customIDPresent checks that the id key is set to a non-empty value
+func customIDPresent(payload CustomEventPayload, key string) bool {
+	found, ok := payload[key]
+	if !ok || found == nil {
+		return false
+	}
+	if str, ok := found.(string); ok {
+		return str != ""
+	}
+	return true
+}
+
+// checkStrictCustomEvent verifies an untyped custom event against the registry when strict mode is enabled
+func checkStrictCustomEvent(eventSubtype string, payload CustomEventPayload) error {
+	customEventRegistry.RLock()
+	defer customEventRegistry.RUnlock()
+	if !customEventRegistry.strict {
+		return nil
+	}
+	schema, found := customEventRegistry.bySubtype[eventSubtype]
+	if !found {
+		return fmt.Errorf("custom event subtype %s has not been registered", eventSubtype)
+	}
+	unknown := []string{}
+	for key := range payload {
+		if key != "subtype" && !schema.keys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("keys not registered for subtype %s: %s", eventSubtype, strings.Join(unknown, ", "))
+	}
+	return nil
+}
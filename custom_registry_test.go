@@ -0,0 +1,69 @@
+package copilot_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBowlFilled struct {
+	UserID  string  `copilot:"user_id,required"`
+	ThingID *string `copilot:"thing_id"`
+	Grams   int     `copilot:"grams"`
+	Food    string  `copilot:"food,omitempty"`
+	Ignored string  `copilot:"-"`
+}
+
+type testNoIDs struct {
+	Grams int `copilot:"grams"`
+}
+
+func TestCustomEventRegistry(t *testing.T) {
+	userID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	subtype := fmt.Sprintf("bowl_filled_%d", rand.Int63n(9999999))
+	timestamp := time.Now().UnixMilli()
+	t.Cleanup(copilot.SaveCustomEvents())
+
+	// registration errors
+	err := copilot.RegisterCustomEvent[testBowlFilled]("")
+	assert.NotNil(t, err)
+	err = copilot.RegisterCustomEvent[string]("not_a_struct")
+	assert.NotNil(t, err)
+	err = copilot.RegisterCustomEvent[testNoIDs]("no_ids")
+	assert.NotNil(t, err)
+
+	// unregistered types cannot be sent
+	err = copilot.SendCustom(timestamp, "", testBowlFilled{UserID: userID})
+	assert.NotNil(t, err)
+
+	err = copilot.RegisterCustomEvent[testBowlFilled](subtype)
+	assert.Nil(t, err)
+	err = copilot.RegisterCustomEvent[testBowlFilled](subtype + "_again")
+	assert.NotNil(t, err)
+
+	// required fields are checked before anything is sent
+	err = copilot.SendCustom(timestamp, "", testBowlFilled{Grams: 10})
+	assert.NotNil(t, err)
+	err = copilot.SendCustom[*testBowlFilled](timestamp, "", nil)
+	assert.NotNil(t, err)
+
+	// strict mode rejects unknown subtypes and keys
+	copilot.SetStrictCustomEvents(true)
+	err = copilot.CustomEvent("unregistered", timestamp, "", copilot.CustomEventPayload{"user_id": userID})
+	assert.NotNil(t, err)
+	err = copilot.CustomEvent(subtype, timestamp, "", copilot.CustomEventPayload{"user_id": userID, "gramz": 10})
+	assert.NotNil(t, err)
+
+	if !copilot.IsSetUp() {
+		t.SkipNow()
+	}
+
+	err = copilot.CustomEvent(subtype, timestamp, "", copilot.CustomEventPayload{"user_id": userID, "grams": 10})
+	assert.Nil(t, err)
+	err = copilot.SendCustom(timestamp+1, "", &testBowlFilled{UserID: userID, Grams: 20, Food: "kibble"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,404 @@
+package copilot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DeadLetter is an event that Copilot rejected as invalid, kept so it can be triaged, fixed and resubmitted
+type DeadLetter struct {
+	ID string `json:"id"`
+	// Event is the event as the caller built it, before any privacy policy was applied. Its payload is
+	// stored as a map so it can be fixed regardless of the original payload type.
+	Event    Event  `json:"event"`
+	Endpoint string `json:"endpoint"`
+	// Error is the reason Copilot gave for rejecting the event
+	Error string `json:"error"`
+	// RejectedAt is the Unix timestamp in milliseconds of when the event was first rejected
+	RejectedAt int64 `json:"rejected_at"`
+	// LastAttemptAt is the Unix timestamp in milliseconds of the most recent rejection
+	LastAttemptAt int64 `json:"last_attempt_at"`
+	Attempts      int   `json:"attempts"`
+}
+
+// DeadLetterGroup is every dead letter that was rejected for the same reason
+type DeadLetterGroup struct {
+	Reason  string       `json:"reason"`
+	Letters []DeadLetter `json:"letters"`
+}
+
+// DeadLetterStore holds rejected events. Implement it to keep them in a database or shared storage.
+type DeadLetterStore interface {
+	// AddDeadLetter stores a new dead letter or replaces the one with the same ID
+	AddDeadLetter(letter DeadLetter) error
+	// GetDeadLetter returns the dead letter, or nil if it does not exist
+	GetDeadLetter(id string) (*DeadLetter, error)
+	// ListDeadLetters returns every stored dead letter, oldest first
+	ListDeadLetters() ([]DeadLetter, error)
+	RemoveDeadLetter(id string) error
+}
+
+// ErrDeadLetterNotFound is returned when a dead letter does not exist in the store
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// WithDeadLetterStore adds every event Copilot rejects as invalid to the store. The caller still receives the
+// InvalidEventError. Since the stored event is the original, before any privacy policy is applied, the store
+// should be treated with the same care as the rest of your user data.
+func WithDeadLetterStore(store DeadLetterStore) Option {
+	return func(config *configStruct) {
+		config.DeadLetters = store
+	}
+}
+
+// MemoryDeadLetterStore is an in-memory DeadLetterStore, mostly useful for tests
+type MemoryDeadLetterStore struct {
+	lock    sync.RWMutex
+	letters map[string]DeadLetter
+}
+
+// NewMemoryDeadLetterStore creates an empty in-memory dead letter store
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		letters: map[string]DeadLetter{},
+	}
+}
+
+// AddDeadLetter stores a new dead letter or replaces the one with the same ID
+func (store *MemoryDeadLetterStore) AddDeadLetter(letter DeadLetter) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.letters[letter.ID] = letter
+	return nil
+}
+
+// GetDeadLetter returns the dead letter, or nil if it does not exist
+func (store *MemoryDeadLetterStore) GetDeadLetter(id string) (*DeadLetter, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	letter, found := store.letters[id]
+	if !found {
+		return nil, nil
+	}
+	return &letter, nil
+}
+
+// ListDeadLetters returns every stored dead letter, oldest first
+func (store *MemoryDeadLetterStore) ListDeadLetters() ([]DeadLetter, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	letters := make([]DeadLetter, 0, len(store.letters))
+	for _, letter := range store.letters {
+		letters = append(letters, letter)
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+// RemoveDeadLetter removes the dead letter
+func (store *MemoryDeadLetterStore) RemoveDeadLetter(id string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.letters, id)
+	return nil
+}
+
+// FileDeadLetterStore keeps each dead letter as a JSON file in a directory. It is the default store
+// when COPILOT_CLIENT_DEAD_LETTER_DIR is set and is what the copilot command reads.
+type FileDeadLetterStore struct {
+	dir string
+}
+
+// NewFileDeadLetterStore creates a store in the directory, creating the directory if needed
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir cannot be blank")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetterStore{
+		dir: dir,
+	}, nil
+}
+
+// AddDeadLetter writes the dead letter to its file, replacing any existing one
+func (store *FileDeadLetterStore) AddDeadLetter(letter DeadLetter) error {
+	if err := validateDeadLetterID(letter.ID); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path(letter.ID), data)
+}
+
+// writeFileAtomic writes to a temp file in the same directory and renames it, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// GetDeadLetter reads the dead letter, or returns nil if it does not exist
+func (store *FileDeadLetterStore) GetDeadLetter(id string) (*DeadLetter, error) {
+	if err := validateDeadLetterID(id); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(store.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	letter := &DeadLetter{}
+	if err := json.Unmarshal(data, letter); err != nil {
+		return nil, fmt.Errorf("dead letter %s could not be read: %w", id, err)
+	}
+	return letter, nil
+}
+
+// ListDeadLetters reads every dead letter in the directory, oldest first
+func (store *FileDeadLetterStore) ListDeadLetters() ([]DeadLetter, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+	letters := []DeadLetter{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		letter, err := store.GetDeadLetter(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if letter != nil {
+			letters = append(letters, *letter)
+		}
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+// RemoveDeadLetter deletes the dead letter's file
+func (store *FileDeadLetterStore) RemoveDeadLetter(id string) error {
+	if err := validateDeadLetterID(id); err != nil {
+		return err
+	}
+	err := os.Remove(store.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (store *FileDeadLetterStore) path(id string) string {
+	return filepath.Join(store.dir, id+".json")
+}
+
+// GroupDeadLetters groups the dead letters by the reason they were rejected, largest group first
+func GroupDeadLetters(letters []DeadLetter) []DeadLetterGroup {
+	byReason := map[string]*DeadLetterGroup{}
+	groups := []*DeadLetterGroup{}
+	for _, letter := range letters {
+		group, found := byReason[letter.Error]
+		if !found {
+			group = &DeadLetterGroup{
+				Reason: letter.Error,
+			}
+			byReason[letter.Error] = group
+			groups = append(groups, group)
+		}
+		group.Letters = append(group.Letters, letter)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Letters) > len(groups[j].Letters)
+	})
+	result := make([]DeadLetterGroup, len(groups))
+	for i, group := range groups {
+		result[i] = *group
+	}
+	return result
+}
+
+// FixDeadLetter loads the dead letter, passes its event to fix and stores the result, so it can be
+// resubmitted. The payload of the event is a map[string]interface{}.
+func FixDeadLetter(store DeadLetterStore, id string, fix func(event *Event) error) error {
+	if store == nil {
+		return errors.New("store cannot be nil")
+	}
+	letter, err := store.GetDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	if letter == nil {
+		return ErrDeadLetterNotFound
+	}
+	if err := fix(&letter.Event); err != nil {
+		return err
+	}
+	return store.AddDeadLetter(*letter)
+}
+
+// ResubmitDeadLetter sends the dead letter again. It is removed from the store if it is accepted; if it is
+// rejected again, its error and attempts are updated and the InvalidEventError is returned.
+func ResubmitDeadLetter(store DeadLetterStore, id string) error {
+	return DefaultClient().ResubmitDeadLetter(store, id)
+}
+
+// ResubmitDeadLetter is the same as the package level ResubmitDeadLetter, using the client's configuration
+func (client *Client) ResubmitDeadLetter(store DeadLetterStore, id string) error {
+	if store == nil {
+		return errors.New("store cannot be nil")
+	}
+	letter, err := store.GetDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	if letter == nil {
+		return ErrDeadLetterNotFound
+	}
+	return client.resubmitDeadLetter(store, *letter)
+}
+
+// ResubmitDeadLetters sends every dead letter rejected for the reason again, or every dead letter if the
+// reason is blank. It returns the number accepted and the first error encountered.
+func ResubmitDeadLetters(store DeadLetterStore, reason string) (int, error) {
+	return DefaultClient().ResubmitDeadLetters(store, reason)
+}
+
+// ResubmitDeadLetters is the same as the package level ResubmitDeadLetters, using the client's configuration
+func (client *Client) ResubmitDeadLetters(store DeadLetterStore, reason string) (int, error) {
+	if store == nil {
+		return 0, errors.New("store cannot be nil")
+	}
+	letters, err := store.ListDeadLetters()
+	if err != nil {
+		return 0, err
+	}
+	accepted := 0
+	var firstErr error
+	for _, letter := range letters {
+		if reason != "" && letter.Error != reason {
+			continue
+		}
+		err := client.resubmitDeadLetter(store, letter)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		accepted++
+	}
+	return accepted, firstErr
+}
+
+// resubmitDeadLetter delivers the letter's event without adding a new dead letter on rejection
+func (client *Client) resubmitDeadLetter(store DeadLetterStore, letter DeadLetter) error {
+	event := letter.Event
+	err := client.deliverEvent(&event)
+	var invalid *InvalidEventError
+	if errors.As(err, &invalid) {
+		letter.Error = invalid.EventError
+		letter.LastAttemptAt = client.now().UnixMilli()
+		letter.Attempts++
+		if storeErr := store.AddDeadLetter(letter); storeErr != nil {
+			return storeErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return store.RemoveDeadLetter(letter.ID)
+}
+
+// addDeadLetter stores an event that Copilot rejected; failures are logged since the caller is already
+// receiving the rejection
+func (config *configStruct) addDeadLetter(event Event, invalid *InvalidEventError) {
+	if config == nil || config.DeadLetters == nil {
+		return
+	}
+	err := config.storeDeadLetter(event, invalid)
+	if err != nil {
+		log.Printf("copilot rejected event %s could not be dead lettered: %v", event.EventID, err)
+	}
+}
+
+func (config *configStruct) storeDeadLetter(event Event, invalid *InvalidEventError) error {
+	// store the payload as a map so the letter reads back the same from any store
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	event.Payload = payload
+
+	id, err := newDeadLetterID()
+	if err != nil {
+		return err
+	}
+	rejectedAt := config.now().UnixMilli()
+	return config.DeadLetters.AddDeadLetter(DeadLetter{
+		ID:            id,
+		Event:         event,
+		Endpoint:      invalid.Endpoint,
+		Error:         invalid.EventError,
+		RejectedAt:    rejectedAt,
+		LastAttemptAt: rejectedAt,
+		Attempts:      1,
+	})
+}
+
+// newDeadLetterID generates a random ID that is safe to use as a file name
+func newDeadLetterID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// validateDeadLetterID makes sure the ID cannot escape the file store's directory
+func validateDeadLetterID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return fmt.Errorf("dead letter id %s is invalid", id)
+	}
+	return nil
+}
+
+// sortDeadLetters orders the dead letters oldest first
+func sortDeadLetters(letters []DeadLetter) {
+	sort.SliceStable(letters, func(i, j int) bool {
+		if letters[i].RejectedAt != letters[j].RejectedAt {
+			return letters[i].RejectedAt < letters[j].RejectedAt
+		}
+		return letters[i].ID < letters[j].ID
+	})
+}
@@ -0,0 +1,87 @@
+package copilot_test
+
+import (
+	"testing"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetters(t *testing.T) {
+	store, err := copilot.NewFileDeadLetterStore(t.TempDir())
+	assert.Nil(t, err)
+
+	// reject consumables without a quantity, which the fix below adds
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDeadLetterStore(store), copilot.WithDryRun(copilot.NewMemorySink()),
+		copilot.WithDryRunValidator(func(event copilot.Event) string {
+			payload := event.Payload.(map[string]interface{})
+			if event.Type == copilot.EventTypeThingConsumableUsage && payload["quantity"] == nil {
+				return "quantity is required"
+			}
+			if event.Type == copilot.EventTypeThingConnected {
+				return "thing is unknown"
+			}
+			return ""
+		}))
+	assert.Nil(t, err)
+
+	err = client.ThingConsumableUsage("thing-1", "user-1", "food", 1600000000000, "")
+	assert.NotNil(t, err)
+	err = client.ThingConsumableUsage("thing-2", "user-1", "food", 1600000000000, "")
+	assert.NotNil(t, err)
+	err = client.ThingConnected("thing-1", "user-1", 1600000000000, "")
+	assert.NotNil(t, err)
+	err = client.ThingDisassociated("thing-1", "user-1", 1600000000000, "")
+	assert.Nil(t, err)
+
+	letters, err := store.ListDeadLetters()
+	assert.Nil(t, err)
+	assert.Len(t, letters, 3)
+	assert.Equal(t, 1, letters[0].Attempts)
+	thingIDs := []interface{}{}
+	for _, letter := range letters {
+		thingIDs = append(thingIDs, letter.Event.Payload.(map[string]interface{})["thing_id"])
+	}
+	assert.ElementsMatch(t, []interface{}{"thing-1", "thing-2", "thing-1"}, thingIDs)
+
+	groups := copilot.GroupDeadLetters(letters)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "quantity is required", groups[0].Reason)
+	assert.Len(t, groups[0].Letters, 2)
+
+	// resubmitting without a fix rejects them again
+	accepted, err := client.ResubmitDeadLetters(store, "quantity is required")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, accepted)
+	letter, err := store.GetDeadLetter(groups[0].Letters[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, letter.Attempts)
+
+	for _, letter := range groups[0].Letters {
+		err = copilot.FixDeadLetter(store, letter.ID, func(event *copilot.Event) error {
+			event.Payload.(map[string]interface{})["quantity"] = 1
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	accepted, err = client.ResubmitDeadLetters(store, "quantity is required")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, accepted)
+
+	letters, err = store.ListDeadLetters()
+	assert.Nil(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "thing is unknown", letters[0].Error)
+
+	err = client.ResubmitDeadLetter(store, "missing")
+	assert.Equal(t, copilot.ErrDeadLetterNotFound, err)
+	err = store.RemoveDeadLetter(letters[0].ID)
+	assert.Nil(t, err)
+	letters, err = store.ListDeadLetters()
+	assert.Nil(t, err)
+	assert.Len(t, letters, 0)
+
+	// ids cannot escape the directory
+	_, err = store.GetDeadLetter("../secrets")
+	assert.NotNil(t, err)
+}
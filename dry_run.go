@@ -0,0 +1,191 @@
+package copilot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// DryRunRecord is a single request that would have been sent to Copilot. For collect calls, Events holds the
+// events exactly as they would have been posted; for consent calls, Consent holds the body.
+type DryRunRecord struct {
+	Endpoint string          `json:"endpoint"`
+	Events   []Event         `json:"events,omitempty"`
+	Consent  *ConsentRequest `json:"consent,omitempty"`
+}
+
+// ConsentRequest is the body sent to the consent endpoint
+type ConsentRequest struct {
+	ConsentValue bool   `json:"consent_value"`
+	UserID       string `json:"user_id"`
+}
+
+// DryRunSink receives the requests built in dry run mode instead of them being posted to Copilot. If Write
+// returns an error, it is returned to the caller as if the request had failed.
+type DryRunSink interface {
+	Write(record DryRunRecord) error
+}
+
+// DryRunValidator checks an event in dry run mode. The event is as it would be posted, so its payload is a
+// map[string]interface{}. Returning a non-empty string simulates Copilot rejecting the event, and the caller
+// receives an InvalidEventError with that message.
+type DryRunValidator func(event Event) string
+
+// WithDryRun validates and builds every request as normal, but writes it to the sink instead of posting it to
+// Copilot. Credentials and endpoints are not required in dry run mode.
+func WithDryRun(sink DryRunSink) Option {
+	return func(config *configStruct) {
+		config.DryRun = sink
+	}
+}
+
+// WithDryRunValidator adds a validator that can simulate invalid events in dry run mode
+func WithDryRunValidator(validator DryRunValidator) Option {
+	return func(config *configStruct) {
+		config.DryRunValidators = append(config.DryRunValidators, validator)
+	}
+}
+
+// LogSink writes each request to the logger as JSON. If the logger is nil, the standard logger is used.
+func LogSink(logger *log.Logger) DryRunSink {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &logSink{
+		logger: logger,
+	}
+}
+
+type logSink struct {
+	logger *log.Logger
+}
+
+func (sink *logSink) Write(record DryRunRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sink.logger.Printf("copilot dry run: %s", data)
+	return nil
+}
+
+// JSONLSink writes each request to the writer as a line of JSON
+func JSONLSink(writer io.Writer) DryRunSink {
+	return &jsonlSink{
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+type jsonlSink struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+func (sink *jsonlSink) Write(record DryRunRecord) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.encoder.Encode(record)
+}
+
+// MemorySink keeps each request in memory so it can be inspected later
+type MemorySink struct {
+	lock    sync.RWMutex
+	records []DryRunRecord
+}
+
+// NewMemorySink creates an empty in-memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Write stores the request
+func (sink *MemorySink) Write(record DryRunRecord) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.records = append(sink.records, record)
+	return nil
+}
+
+// Records returns a copy of every request written so far
+func (sink *MemorySink) Records() []DryRunRecord {
+	sink.lock.RLock()
+	defer sink.lock.RUnlock()
+	records := make([]DryRunRecord, len(sink.records))
+	copy(records, sink.records)
+	return records
+}
+
+// Events returns every event written so far, in order
+func (sink *MemorySink) Events() []Event {
+	sink.lock.RLock()
+	defer sink.lock.RUnlock()
+	events := []Event{}
+	for _, record := range sink.records {
+		events = append(events, record.Events...)
+	}
+	return events
+}
+
+// Reset removes every request written so far
+func (sink *MemorySink) Reset() {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	sink.records = nil
+}
+
+// validateDryRunEvent performs the checks Copilot would on the event, followed by any configured validators
+func validateDryRunEvent(event Event, validators []DryRunValidator) string {
+	if event.EventID == "" {
+		return "event_id is required"
+	}
+	if len(event.EventID) > 50 {
+		return "event_id cannot be longer than 50 characters"
+	}
+	if event.Timestamp <= 0 {
+		return fmt.Sprintf("timestamp %d is invalid", event.Timestamp)
+	}
+	for _, validator := range validators {
+		if message := validator(event); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// dryRunCollect writes the collect request to the sink and simulates the response
+func dryRunCollect(config *configStruct, data eventRequest) (*EventResponse, error) {
+	// round trip the request through JSON so the sink sees exactly what would have been posted
+	postBody, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	sent := eventRequest{}
+	err = json.Unmarshal(postBody, &sent)
+	if err != nil {
+		return nil, err
+	}
+	err = config.DryRun.Write(DryRunRecord{
+		Endpoint: config.CollectEndpoint,
+		Events:   sent.Events,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &EventResponse{
+		InvalidEvents: []InvalidEventError{},
+		Endpoint:      config.CollectEndpoint,
+	}
+	for index, event := range sent.Events {
+		if message := validateDryRunEvent(event, config.DryRunValidators); message != "" {
+			response.InvalidEvents = append(response.InvalidEvents, InvalidEventError{
+				EventID:    event.EventID,
+				Index:      index,
+				EventError: message,
+			})
+		}
+	}
+	return response, nil
+}
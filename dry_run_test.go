@@ -0,0 +1,80 @@
+package copilot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	userID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	thingID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	email := fmt.Sprintf("%s@wagz.com", userID)
+	timestamp := time.Now().UnixMilli()
+	defer copilot.SaveConfig()()
+
+	// a sink is required, but credentials are not
+	err := copilot.Setup("", "", "", "", copilot.WithDryRun(nil))
+	assert.NotNil(t, err)
+
+	sink := copilot.NewMemorySink()
+	err = copilot.Setup("", "", "", "", copilot.WithDryRun(sink), copilot.WithDryRunValidator(func(event copilot.Event) string {
+		if event.Type == copilot.EventTypeThingInteraction {
+			return "interactions are not allowed"
+		}
+		return ""
+	}))
+	assert.Nil(t, err)
+	assert.True(t, copilot.IsSetUp())
+
+	err = copilot.UserCreated(userID, timestamp, "", &copilot.UserEventPayload{
+		Email: copilot.String(email),
+	})
+	assert.Nil(t, err)
+	err = copilot.UpdateUserConsent(userID, true)
+	assert.Nil(t, err)
+	err = copilot.ThingIneraction(thingID, timestamp, "", nil)
+	assert.NotNil(t, err)
+	_, ok := err.(*copilot.InvalidEventError)
+	assert.True(t, ok)
+	// the local checks still happen first
+	err = copilot.UserCreated("", timestamp, "", nil)
+	assert.NotNil(t, err)
+
+	records := sink.Records()
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, copilot.EventTypeUserCreated, records[0].Events[0].Type)
+		assert.Equal(t, timestamp, records[0].Events[0].Timestamp)
+		assert.Equal(t, email, records[0].Events[0].Payload.(map[string]interface{})["email"])
+		assert.Equal(t, userID, records[1].Consent.UserID)
+		assert.True(t, records[1].Consent.ConsentValue)
+		assert.Equal(t, copilot.EventTypeThingInteraction, records[2].Events[0].Type)
+	}
+	assert.Len(t, sink.Events(), 2)
+	sink.Reset()
+	assert.Empty(t, sink.Records())
+
+	// the requests can also be written as JSON lines
+	buffer := &bytes.Buffer{}
+	err = copilot.Setup("", "", "", "", copilot.WithDryRun(copilot.JSONLSink(buffer)))
+	assert.Nil(t, err)
+	err = copilot.UserDeleted(userID, timestamp, "")
+	assert.Nil(t, err)
+	err = copilot.UserDeleted(userID, timestamp+1, "")
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		record := copilot.DryRunRecord{}
+		err = json.Unmarshal([]byte(lines[1]), &record)
+		assert.Nil(t, err)
+		assert.Equal(t, copilot.EventTypeUserDeleted, record.Events[0].Type)
+		assert.Equal(t, timestamp+1, record.Events[0].Timestamp)
+	}
+}
@@ -0,0 +1,64 @@
+package copilot
+
+import (
+	"time"
+)
+
+// Emitter sends events and consent updates to Copilot. It is implemented by Client, and by the Recorder in the
+// copilottest package, so application code that depends on an Emitter can be tested without a Copilot instance.
+type Emitter interface {
+	UserCreated(userID string, timestamp int64, eventID string, payload *UserEventPayload) error
+	UserUpdated(userID string, timestamp int64, eventID string, payload *UserEventPayload) error
+	UserDeleted(userID string, timestamp int64, eventID string) error
+	ThingCreated(thingID string, timestamp int64, eventID string, payload *ThingCreatedUpdatedPayload) error
+	ThingUpdated(thingID string, timestamp int64, eventID string, payload *ThingCreatedUpdatedPayload) error
+	ThingAssociated(thingID string, userID string, timestamp int64, eventID string) error
+	ThingDisassociated(thingID string, userID string, timestamp int64, eventID string) error
+	ThingStatusChanged(thingID string, timestamp int64, eventID string, payload *ThingStatusChangedPayload) error
+	ThingIneraction(thingID string, timestamp int64, eventID string, payload ThingInteractionEventPayload) error
+	ThingConnected(thingID string, userID string, timestamp int64, eventID string) error
+	ThingConsumableUsage(thingID string, userID string, consumableType string, timestamp int64, eventID string) error
+	ThingConsumableUsageQuantity(thingID string, userID string, consumableType string, quantity float64, unit string, timestamp int64, eventID string) error
+	ThingFirmwareUpgradeStarted(thingID string, userID string, firmwareVersion string, timestamp int64, eventID string) error
+	ThingFirmwareUpgradeCompleted(thingID string, userID string, firmwareVersion string, timestamp int64, eventID string) error
+	CustomEvent(eventSubtype string, timestamp int64, eventID string, payload CustomEventPayload) error
+	UnsubscribeUserEmail(email string, timestamp int64, eventID string) error
+	SyncStarted(timestamp int64, eventID string) error
+	SyncCompleted(timestamp int64, eventID string) error
+	PreexistingUserCreated(userID string, timestamp int64, eventID string, payload *PreexistingUserEventPayload) error
+	PreexistingThingCreated(thingID string, timestamp int64, eventID string, payload *PreexistingThingCreatedPayload) error
+	PreexistingThingUserAssociated(thingID string, userID string, timestamp int64, eventID string, originalAssociationDate int64) error
+	TransferThing(thingID string, fromUserID string, toUserID string, timestamp int64, compensate bool) error
+	ReplaceThing(oldThingID string, newThingID string, timestamp int64, payload *ThingReplacementPayload) error
+	MergeUsers(anonymousID string, realID string, timestamp int64, payload *UserEventPayload, deleteAnonymous bool) error
+	UpdateUserConsent(userID string, consentValue bool) error
+
+	UserCreatedAt(userID string, at time.Time, eventID string, payload *UserEventPayload) error
+	UserUpdatedAt(userID string, at time.Time, eventID string, payload *UserEventPayload) error
+	UserDeletedAt(userID string, at time.Time, eventID string) error
+	ThingCreatedAt(thingID string, at time.Time, eventID string, payload *ThingCreatedUpdatedPayload) error
+	ThingUpdatedAt(thingID string, at time.Time, eventID string, payload *ThingCreatedUpdatedPayload) error
+	ThingAssociatedAt(thingID string, userID string, at time.Time, eventID string) error
+	ThingDisassociatedAt(thingID string, userID string, at time.Time, eventID string) error
+	ThingStatusChangedAt(thingID string, at time.Time, eventID string, payload *ThingStatusChangedPayload) error
+	ThingIneractionAt(thingID string, at time.Time, eventID string, payload ThingInteractionEventPayload) error
+	ThingConnectedAt(thingID string, userID string, at time.Time, eventID string) error
+	ThingConsumableUsageAt(thingID string, userID string, consumableType string, at time.Time, eventID string) error
+	ThingConsumableUsageQuantityAt(thingID string, userID string, consumableType string, quantity float64, unit string, at time.Time, eventID string) error
+	ThingFirmwareUpgradeStartedAt(thingID string, userID string, firmwareVersion string, at time.Time, eventID string) error
+	ThingFirmwareUpgradeCompletedAt(thingID string, userID string, firmwareVersion string, at time.Time, eventID string) error
+	CustomEventAt(eventSubtype string, at time.Time, eventID string, payload CustomEventPayload) error
+	UnsubscribeUserEmailAt(email string, at time.Time, eventID string) error
+	SyncStartedAt(at time.Time, eventID string) error
+	SyncCompletedAt(at time.Time, eventID string) error
+	PreexistingUserCreatedAt(userID string, at time.Time, eventID string, payload *PreexistingUserEventPayload) error
+	PreexistingThingCreatedAt(thingID string, at time.Time, eventID string, payload *PreexistingThingCreatedPayload) error
+	PreexistingThingUserAssociatedAt(thingID string, userID string, at time.Time, eventID string, originalAssociationDate int64) error
+	TransferThingAt(thingID string, fromUserID string, toUserID string, at time.Time, compensate bool) error
+	ReplaceThingAt(oldThingID string, newThingID string, at time.Time, payload *ThingReplacementPayload) error
+	MergeUsersAt(anonymousID string, realID string, at time.Time, payload *UserEventPayload, deleteAnonymous bool) error
+	UpdateUserConsentAt(userID string, consentValue bool, at time.Time) error
+}
+
+// make sure the client always implements the interface
+var _ Emitter = (*Client)(nil)
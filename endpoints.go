@@ -0,0 +1,242 @@
+package copilot
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// below are the kinds of endpoints a client calls
+const (
+	EndpointKindCollect = "collect"
+	EndpointKindConsent = "consent"
+)
+
+// defaultEndpointCooldown is how long an unhealthy endpoint is skipped when the cooldown is not configured
+const defaultEndpointCooldown = 30 * time.Second
+
+// EndpointError is returned when a request could not be completed by any endpoint, either because of a
+// connection error, a server error, or an unexpected status. Endpoint is the last endpoint tried.
+type EndpointError struct {
+	Kind     string
+	Endpoint string
+	// StatusCode is the HTTP status received, or 0 if the request could not be made
+	StatusCode int
+	Err        error
+}
+
+func (err *EndpointError) Error() string {
+	if err.StatusCode != 0 {
+		return fmt.Sprintf("copilot %s endpoint %s returned a %d: %v", err.Kind, err.Endpoint, err.StatusCode, err.Err)
+	}
+	return fmt.Sprintf("copilot %s endpoint %s failed: %v", err.Kind, err.Endpoint, err.Err)
+}
+
+func (err *EndpointError) Unwrap() error {
+	return err.Err
+}
+
+// RequestResult describes a single request to an endpoint, for reporting to metrics
+type RequestResult struct {
+	Kind     string
+	Endpoint string
+	// StatusCode is the HTTP status received, or 0 if the request could not be made
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+	// FailedOver is true if an earlier endpoint was tried and failed for the same call
+	FailedOver bool
+}
+
+// EndpointStatus is a snapshot of the health of an endpoint
+type EndpointStatus struct {
+	Kind     string `json:"kind"`
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	Requests int64  `json:"requests"`
+	Failures int64  `json:"failures"`
+	// ConsecutiveFailures is the number of failures since the last successful request
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// WithFallbackEndpoints adds endpoints to try, in order, when the collect or consent endpoint passed to Setup
+// fails with a connection error or a 5xx. Failed endpoints are skipped for a cooldown, after which they are
+// tried again; requests move back to the primary as soon as it succeeds.
+func WithFallbackEndpoints(collectEndpoints []string, consentEndpoints []string) Option {
+	return func(config *configStruct) {
+		config.CollectFallbacks = append(config.CollectFallbacks, collectEndpoints...)
+		config.ConsentFallbacks = append(config.ConsentFallbacks, consentEndpoints...)
+	}
+}
+
+// WithEndpointCooldown sets how long a failed endpoint is skipped before it is tried again; it defaults to 30 seconds
+func WithEndpointCooldown(cooldown time.Duration) Option {
+	return func(config *configStruct) {
+		config.EndpointCooldown = cooldown
+	}
+}
+
+// WithRequestObserver calls the observer after every request to an endpoint, such as to record metrics
+func WithRequestObserver(observer func(result RequestResult)) Option {
+	return func(config *configStruct) {
+		config.RequestObserver = observer
+	}
+}
+
+// endpointPool is an ordered list of endpoints of the same kind with their health
+type endpointPool struct {
+	kind      string
+	lock      sync.Mutex
+	endpoints []*endpointState
+}
+
+// endpointState is the health of a single endpoint
+type endpointState struct {
+	url                 string
+	requests            int64
+	failures            int64
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+	lastError           string
+}
+
+// newEndpointPool creates a pool with the primary followed by the fallbacks, skipping blanks and duplicates
+func newEndpointPool(kind string, primary string, fallbacks []string) *endpointPool {
+	pool := &endpointPool{
+		kind: kind,
+	}
+	seen := map[string]bool{}
+	for _, url := range append([]string{primary}, fallbacks...) {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		pool.endpoints = append(pool.endpoints, &endpointState{
+			url: url,
+		})
+	}
+	return pool
+}
+
+// candidates returns the healthy endpoints in order, followed by the unhealthy ones, so that a request is
+// still attempted when every endpoint is cooling down
+func (pool *endpointPool) candidates(now time.Time) []*endpointState {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	healthy := []*endpointState{}
+	unhealthy := []*endpointState{}
+	for _, endpoint := range pool.endpoints {
+		if now.Before(endpoint.unhealthyUntil) {
+			unhealthy = append(unhealthy, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// record updates the health of the endpoint after a request
+func (pool *endpointPool) record(endpoint *endpointState, failed bool, err error, now time.Time, cooldown time.Duration) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	endpoint.requests++
+	if !failed {
+		endpoint.consecutiveFailures = 0
+		endpoint.unhealthyUntil = time.Time{}
+		return
+	}
+	endpoint.failures++
+	endpoint.consecutiveFailures++
+	endpoint.unhealthyUntil = now.Add(cooldown)
+	if err != nil {
+		endpoint.lastError = err.Error()
+	}
+}
+
+// status returns a snapshot of the health of every endpoint in the pool
+func (pool *endpointPool) status(now time.Time) []EndpointStatus {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	statuses := []EndpointStatus{}
+	for _, endpoint := range pool.endpoints {
+		statuses = append(statuses, EndpointStatus{
+			Kind:                pool.kind,
+			Endpoint:            endpoint.url,
+			Healthy:             !now.Before(endpoint.unhealthyUntil),
+			Requests:            endpoint.requests,
+			Failures:            endpoint.failures,
+			ConsecutiveFailures: endpoint.consecutiveFailures,
+			LastError:           endpoint.lastError,
+		})
+	}
+	return statuses
+}
+
+// call makes the request against each endpoint in turn until one does not fail with a connection error or a
+// 5xx. The request returns the status received, or 0 if the request could not be made, and an error for any
+// unsuccessful result. Errors from a non-retryable status are returned as they are.
+func (pool *endpointPool) call(config *configStruct, request func(endpoint string) (int, error)) error {
+	cooldown := config.EndpointCooldown
+	if cooldown <= 0 {
+		cooldown = defaultEndpointCooldown
+	}
+	candidates := pool.candidates(config.now())
+	if len(candidates) == 0 {
+		return &EndpointError{
+			Kind: pool.kind,
+			Err:  fmt.Errorf("no %s endpoint is configured", pool.kind),
+		}
+	}
+
+	var lastErr *EndpointError
+	for i, endpoint := range candidates {
+		started := time.Now()
+		statusCode, err := request(endpoint.url)
+		failed := statusCode == 0 || statusCode >= http.StatusInternalServerError
+		if err == nil {
+			failed = false
+		}
+		pool.record(endpoint, failed, err, config.now(), cooldown)
+		if config.RequestObserver != nil {
+			config.RequestObserver(RequestResult{
+				Kind:       pool.kind,
+				Endpoint:   endpoint.url,
+				StatusCode: statusCode,
+				Duration:   time.Since(started),
+				Err:        err,
+				FailedOver: i > 0,
+			})
+		}
+		if !failed {
+			return err
+		}
+		if endpointErr, ok := err.(*EndpointError); ok {
+			lastErr = endpointErr
+			continue
+		}
+		lastErr = &EndpointError{
+			Kind:       pool.kind,
+			Endpoint:   endpoint.url,
+			StatusCode: statusCode,
+			Err:        err,
+		}
+	}
+	return lastErr
+}
+
+// EndpointStatuses returns the health of the default client's collect and consent endpoints
+func EndpointStatuses() []EndpointStatus {
+	return DefaultClient().EndpointStatuses()
+}
+
+// EndpointStatuses is the same as the package level EndpointStatuses, using the client's configuration
+func (client *Client) EndpointStatuses() []EndpointStatus {
+	config := client.configuration()
+	if config == nil {
+		return []EndpointStatus{}
+	}
+	now := config.now()
+	return append(config.collectPool.status(now), config.consentPool.status(now)...)
+}
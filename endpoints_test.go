@@ -0,0 +1,118 @@
+package copilot_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointFailover(t *testing.T) {
+	var primaryDown int32 = 1
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&primaryDown) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"reason":"unavailable","error_message":"try again"}`))
+			return
+		}
+		w.Write([]byte(`{"invalid_events":[]}`))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/consent" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"invalid_events":[{"event_id":"rejected","index":0,"error":"bad event"}]}`))
+	}))
+	defer secondary.Close()
+	// a closed server gives a connection error
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	lock := sync.Mutex{}
+	results := []copilot.RequestResult{}
+	client, err := copilot.NewClient("id", "secret", primary.URL, unreachable.URL+"/consent",
+		copilot.WithFallbackEndpoints([]string{secondary.URL}, []string{secondary.URL + "/consent"}),
+		copilot.WithEndpointCooldown(50*time.Millisecond),
+		copilot.WithRequestObserver(func(result copilot.RequestResult) {
+			lock.Lock()
+			results = append(results, result)
+			lock.Unlock()
+		}))
+	assert.Nil(t, err)
+
+	// the primary returns a 503, so the secondary is used
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	assert.Len(t, results, 2)
+	assert.Equal(t, primary.URL, results[0].Endpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, results[0].StatusCode)
+	assert.Equal(t, secondary.URL, results[1].Endpoint)
+	assert.True(t, results[1].FailedOver)
+
+	// the primary is skipped during the cooldown
+	err = client.UserDeleted("user-1", 0, "rejected")
+	invalid := &copilot.InvalidEventError{}
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, secondary.URL, invalid.Endpoint)
+	assert.Len(t, results, 3)
+
+	statuses := client.EndpointStatuses()
+	assert.Len(t, statuses, 4)
+	assert.Equal(t, copilot.EndpointKindCollect, statuses[0].Kind)
+	assert.False(t, statuses[0].Healthy)
+	assert.Equal(t, int64(1), statuses[0].Failures)
+	assert.True(t, statuses[1].Healthy)
+
+	// consent fails over on connection errors
+	assert.Nil(t, client.UpdateUserConsent("user-1", true))
+	assert.Len(t, results, 5)
+	assert.Equal(t, 0, results[3].StatusCode)
+	assert.NotNil(t, results[3].Err)
+
+	// once the primary recovers and the cooldown passes, it is used again
+	atomic.StoreInt32(&primaryDown, 0)
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	assert.Equal(t, primary.URL, results[len(results)-1].Endpoint)
+	assert.True(t, client.EndpointStatuses()[0].Healthy)
+}
+
+func TestEndpointFailoverExhausted(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"reason":"bad gateway","error_message":"upstream failed"}`))
+	}))
+	defer down.Close()
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"reason":"unauthorized","error_message":"bad credentials"}`))
+	}))
+	defer unauthorized.Close()
+
+	client, err := copilot.NewClient("id", "secret", down.URL, "")
+	assert.Nil(t, err)
+	err = client.UserDeleted("user-1", 0, "")
+	endpointErr := &copilot.EndpointError{}
+	assert.True(t, errors.As(err, &endpointErr))
+	assert.Equal(t, down.URL, endpointErr.Endpoint)
+	assert.Equal(t, http.StatusBadGateway, endpointErr.StatusCode)
+	responseErr := &copilot.EventResponseError{}
+	assert.True(t, errors.As(err, &responseErr))
+	assert.Equal(t, "bad gateway", responseErr.Reason)
+
+	// client errors are not retried and are returned as they are
+	client, err = copilot.NewClient("id", "secret", unauthorized.URL, "", copilot.WithFallbackEndpoints([]string{down.URL}, nil))
+	assert.Nil(t, err)
+	err = client.UserDeleted("user-1", 0, "")
+	responseErr, ok := err.(*copilot.EventResponseError)
+	assert.True(t, ok)
+	assert.Equal(t, unauthorized.URL, responseErr.Endpoint)
+	assert.Equal(t, int64(0), client.EndpointStatuses()[1].Requests)
+}
@@ -0,0 +1,311 @@
+package copilot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// below are the steps of EraseUser, in the order they run
+const (
+	ErasureStepWithdrawConsent    = "withdraw_consent"
+	ErasureStepDisassociateThings = "disassociate_things"
+	ErasureStepUserDeleted        = "user_deleted"
+	ErasureStepPurgeEvents        = "purge_events"
+)
+
+// erasureSteps is the order the steps run in
+var erasureSteps = []string{
+	ErasureStepWithdrawConsent,
+	ErasureStepDisassociateThings,
+	ErasureStepUserDeleted,
+	ErasureStepPurgeEvents,
+}
+
+// ErasureStep is the progress of a single step of an erasure
+type ErasureStep struct {
+	Name string `json:"name"`
+	// CompletedAt is the Unix timestamp in milliseconds the step completed, or 0 if it has not
+	CompletedAt int64 `json:"completed_at,omitempty"`
+	Attempts    int   `json:"attempts"`
+	// Error is the error from the last attempt, cleared once the step completes
+	Error string `json:"error,omitempty"`
+	Note  string `json:"note,omitempty"`
+}
+
+// ErasureRecord is the audit record of erasing a user, kept as proof of what was done and when
+type ErasureRecord struct {
+	UserID      string        `json:"user_id"`
+	StartedAt   int64         `json:"started_at"`
+	CompletedAt int64         `json:"completed_at,omitempty"`
+	Steps       []ErasureStep `json:"steps"`
+	// ThingsDisassociated are the things that were disassociated from the user
+	ThingsDisassociated []string `json:"things_disassociated"`
+	// QueuedEventsPurged is the number of events mentioning the user that were removed from the background queue
+	QueuedEventsPurged int `json:"queued_events_purged"`
+	// DeadLettersPurged are the IDs of the dead letters mentioning the user that were removed
+	DeadLettersPurged []string `json:"dead_letters_purged"`
+}
+
+// Completed is true once every step has completed
+func (record *ErasureRecord) Completed() bool {
+	return record.CompletedAt != 0
+}
+
+// ErasureStore keeps erasure records so that an interrupted erasure can be resumed and a completed one is not
+// repeated. Implement it to keep the records in a database.
+type ErasureStore interface {
+	// GetErasure returns the record for the user, or nil if they have not been erased
+	GetErasure(userID string) (*ErasureRecord, error)
+	SaveErasure(record ErasureRecord) error
+}
+
+// WithErasureStore keeps erasure records in the store. By default they are kept in memory, so an erasure can
+// only be resumed by the same process.
+func WithErasureStore(store ErasureStore) Option {
+	return func(config *configStruct) {
+		config.Erasures = store
+	}
+}
+
+// MemoryErasureStore is an in-memory ErasureStore
+type MemoryErasureStore struct {
+	lock    sync.RWMutex
+	records map[string]ErasureRecord
+}
+
+// NewMemoryErasureStore creates an empty in-memory erasure store
+func NewMemoryErasureStore() *MemoryErasureStore {
+	return &MemoryErasureStore{
+		records: map[string]ErasureRecord{},
+	}
+}
+
+// GetErasure returns a copy of the record for the user, or nil if there is none
+func (store *MemoryErasureStore) GetErasure(userID string) (*ErasureRecord, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	record, found := store.records[userID]
+	if !found {
+		return nil, nil
+	}
+	record.Steps = append([]ErasureStep{}, record.Steps...)
+	record.ThingsDisassociated = append([]string{}, record.ThingsDisassociated...)
+	record.DeadLettersPurged = append([]string{}, record.DeadLettersPurged...)
+	return &record, nil
+}
+
+// SaveErasure replaces the record for the user
+func (store *MemoryErasureStore) SaveErasure(record ErasureRecord) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.records[record.UserID] = record
+	return nil
+}
+
+// FileErasureStore keeps each erasure record as a JSON file in a directory. The files are named by a hash of
+// the user ID, so the directory listing does not reveal who was erased.
+type FileErasureStore struct {
+	dir string
+}
+
+// NewFileErasureStore creates a store in the directory, creating the directory if needed
+func NewFileErasureStore(dir string) (*FileErasureStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir cannot be blank")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileErasureStore{
+		dir: dir,
+	}, nil
+}
+
+// GetErasure reads the record for the user, or returns nil if there is none
+func (store *FileErasureStore) GetErasure(userID string) (*ErasureRecord, error) {
+	data, err := os.ReadFile(store.path(userID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &ErasureRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("erasure record could not be read: %w", err)
+	}
+	return record, nil
+}
+
+// SaveErasure writes the record to its file, replacing any existing one
+func (store *FileErasureStore) SaveErasure(record ErasureRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path(record.UserID), data)
+}
+
+func (store *FileErasureStore) path(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return filepath.Join(store.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// EraseUser erases a user from Copilot for a GDPR erasure request. It withdraws their consent, disassociates
+// every thing in the association store, sends UserDeleted, and then removes any queued events and dead letters
+// that mention them. Each event is delivered before the next step starts, even when background sending is
+// enabled. Before anything is sent, the queued events that mention the user are removed and any being sent
+// are waited for, so that none can reach Copilot after UserDeleted. Progress is saved to the erasure store
+// after every step, so calling it again after a failure resumes where it stopped, and calling it for a user
+// that was already erased returns the existing record without sending anything.
+func EraseUser(ctx context.Context, userID string) (*ErasureRecord, error) {
+	return DefaultClient().EraseUser(ctx, userID)
+}
+
+// EraseUser is the same as the package level EraseUser, using the client's configuration
+func (client *Client) EraseUser(ctx context.Context, userID string) (*ErasureRecord, error) {
+	if userID == "" {
+		return nil, errors.New("userID cannot be blank")
+	}
+	config := client.configuration()
+	if config == nil {
+		return nil, errors.New("copilot client not configured")
+	}
+
+	record, err := config.Erasures.GetErasure(userID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		record = &ErasureRecord{
+			UserID:              userID,
+			StartedAt:           client.now().UnixMilli(),
+			ThingsDisassociated: []string{},
+			DeadLettersPurged:   []string{},
+		}
+		for _, name := range erasureSteps {
+			record.Steps = append(record.Steps, ErasureStep{Name: name})
+		}
+	}
+	if record.Completed() {
+		return record, nil
+	}
+
+	// the erasure's events skip the queue, so clear the user's queued events first in case one would be
+	// delivered after them
+	record.QueuedEventsPurged += config.sender.purge(func(event Event) bool {
+		return eventMentionsUser(event, userID)
+	})
+	if err := config.sender.wait(ctx, func(event Event) bool {
+		return eventMentionsUser(event, userID)
+	}); err != nil {
+		return record, err
+	}
+
+	immediate := client.immediately()
+	for i := range record.Steps {
+		step := &record.Steps[i]
+		if step.CompletedAt != 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return record, err
+		}
+		step.Attempts++
+		if err := immediate.runErasureStep(ctx, record, step); err != nil {
+			step.Error = err.Error()
+			if saveErr := config.Erasures.SaveErasure(*record); saveErr != nil {
+				return record, saveErr
+			}
+			return record, fmt.Errorf("erasure of %s stopped at %s: %w", userID, step.Name, err)
+		}
+		step.Error = ""
+		step.CompletedAt = client.now().UnixMilli()
+		if err := config.Erasures.SaveErasure(*record); err != nil {
+			return record, err
+		}
+	}
+	record.CompletedAt = client.now().UnixMilli()
+	return record, config.Erasures.SaveErasure(*record)
+}
+
+// runErasureStep runs a single step of the erasure, updating the record with what was done
+func (client *Client) runErasureStep(ctx context.Context, record *ErasureRecord, step *ErasureStep) error {
+	config := client.configuration()
+	switch step.Name {
+	case ErasureStepWithdrawConsent:
+		return client.UpdateUserConsent(record.UserID, false)
+
+	case ErasureStepDisassociateThings:
+		if config.Associations == nil {
+			step.Note = "no association store is configured, so no things were disassociated"
+			return nil
+		}
+		// the store drops each association as it is sent, so a resumed step only sees the remaining things
+		things, err := config.Associations.ThingsForUser(record.UserID)
+		if err != nil {
+			return err
+		}
+		for _, thingID := range things {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := client.ThingDisassociated(thingID, record.UserID, 0, ""); err != nil {
+				return err
+			}
+			record.ThingsDisassociated = append(record.ThingsDisassociated, thingID)
+			if err := config.Erasures.SaveErasure(*record); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ErasureStepUserDeleted:
+		return client.UserDeleted(record.UserID, 0, "")
+
+	case ErasureStepPurgeEvents:
+		mentions := func(event Event) bool {
+			return eventMentionsUser(event, record.UserID)
+		}
+		record.QueuedEventsPurged += config.sender.purge(mentions)
+		if config.DeadLetters == nil {
+			return nil
+		}
+		letters, err := config.DeadLetters.ListDeadLetters()
+		if err != nil {
+			return err
+		}
+		for _, letter := range letters {
+			if !mentions(letter.Event) {
+				continue
+			}
+			if err := config.DeadLetters.RemoveDeadLetter(letter.ID); err != nil {
+				return err
+			}
+			record.DeadLettersPurged = append(record.DeadLettersPurged, letter.ID)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown erasure step %s", step.Name)
+}
+
+// eventMentionsUser is true when any of the event's payload keys for user IDs has the user's ID
+func eventMentionsUser(event Event, userID string) bool {
+	payload, err := payloadToMap(event.Payload)
+	if err != nil {
+		return false
+	}
+	for _, key := range userIDKeys {
+		if payload[key] == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package copilot_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEraseUser(t *testing.T) {
+	erasures, err := copilot.NewFileErasureStore(t.TempDir())
+	assert.Nil(t, err)
+	deadLetters := copilot.NewMemoryDeadLetterStore()
+	associations := copilot.NewMemoryAssociationStore()
+	recorder := copilottest.NewRecorder(copilot.WithErasureStore(erasures), copilot.WithDeadLetterStore(deadLetters),
+		copilot.WithAssociationStore(associations))
+
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "user-1", 0, ""))
+	assert.Nil(t, recorder.PreexistingThingUserAssociated("thing-2", "user-1", 0, "", 0))
+	assert.Nil(t, recorder.ThingAssociated("thing-2", "user-2", 0, ""))
+	recorder.RejectOn(copilot.EventTypeThingConnected, "thing is unknown")
+	assert.NotNil(t, recorder.ThingConnected("thing-1", "user-1", 0, ""))
+	assert.NotNil(t, recorder.ThingConnected("thing-2", "user-2", 0, ""))
+	recorder.ClearFailures()
+	recorder.Reset()
+
+	// the first disassociation fails, stopping the erasure
+	recorder.FailOn(copilot.EventTypeThingDisassociated, errors.New("copilot is down"), 1)
+	record, err := recorder.EraseUser(context.Background(), "user-1")
+	assert.NotNil(t, err)
+	assert.False(t, record.Completed())
+	assert.NotZero(t, record.Steps[0].CompletedAt)
+	assert.Equal(t, copilot.ErasureStepDisassociateThings, record.Steps[1].Name)
+	assert.Equal(t, "copilot is down", record.Steps[1].Error)
+	assert.Len(t, recorder.ConsentUpdates(), 1)
+	recorder.AssertNotEmitted(t, copilot.EventTypeUserDeleted, "user-1")
+
+	// resuming picks up where it stopped without withdrawing consent again
+	record, err = recorder.EraseUser(context.Background(), "user-1")
+	assert.Nil(t, err)
+	assert.True(t, record.Completed())
+	assert.Len(t, recorder.ConsentUpdates(), 1)
+	assert.Equal(t, []string{"thing-1", "thing-2"}, record.ThingsDisassociated)
+	assert.Equal(t, 2, record.Steps[1].Attempts)
+	assert.Empty(t, record.Steps[1].Error)
+	recorder.AssertEmitted(t, copilot.EventTypeThingDisassociated, "user-1", map[string]interface{}{"thing_id": "thing-2"})
+	recorder.AssertEmitted(t, copilot.EventTypeUserDeleted, "user-1", nil)
+	assert.Len(t, record.DeadLettersPurged, 1)
+
+	things, err := associations.ThingsForUser("user-1")
+	assert.Nil(t, err)
+	assert.Empty(t, things)
+	users, err := associations.UsersForThing("thing-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-2"}, users)
+	letters, err := deadLetters.ListDeadLetters()
+	assert.Nil(t, err)
+	assert.Len(t, letters, 1)
+
+	// erasing again returns the saved record without sending anything
+	recorder.Reset()
+	again, err := recorder.EraseUser(context.Background(), "user-1")
+	assert.Nil(t, err)
+	assert.Equal(t, record.CompletedAt, again.CompletedAt)
+	assert.Empty(t, recorder.Records())
+
+	_, err = recorder.EraseUser(context.Background(), "")
+	assert.NotNil(t, err)
+}
+
+// holdFirstSink blocks the first write until it is released
+type holdFirstSink struct {
+	release chan struct{}
+	held    int32
+	sink    *copilot.MemorySink
+}
+
+func (sink *holdFirstSink) Write(record copilot.DryRunRecord) error {
+	if atomic.CompareAndSwapInt32(&sink.held, 0, 1) {
+		<-sink.release
+	}
+	return sink.sink.Write(record)
+}
+
+func TestEraseUserPurgesQueue(t *testing.T) {
+	sink := &holdFirstSink{
+		release: make(chan struct{}),
+		sink:    copilot.NewMemorySink(),
+	}
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithBackgroundSending(10, 1, nil))
+	assert.Nil(t, err)
+
+	// the worker holds the first event, so the next two stay queued
+	assert.Nil(t, client.UserUpdated("user-0", 0, "", nil))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, client.UserUpdated("user-1", 0, "", nil))
+	assert.Nil(t, client.ThingConnected("thing-1", "user-2", 0, ""))
+
+	// without an association store, the things cannot be found
+	record, err := client.EraseUser(context.Background(), "user-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, record.QueuedEventsPurged)
+	assert.NotEmpty(t, record.Steps[1].Note)
+
+	close(sink.release)
+	assert.Nil(t, client.Flush(context.Background()))
+	types := []string{}
+	for _, event := range sink.sink.Events() {
+		types = append(types, event.Type)
+	}
+	assert.ElementsMatch(t, []string{copilot.EventTypeUserDeleted, copilot.EventTypeUserUpdated, copilot.EventTypeThingConnected}, types)
+}
+
+func TestEraseUserWaitsForEventsInFlight(t *testing.T) {
+	sink := &holdFirstSink{
+		release: make(chan struct{}),
+		sink:    copilot.NewMemorySink(),
+	}
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithBackgroundSending(10, 1, nil))
+	assert.Nil(t, err)
+
+	// the worker holds an event for the user, and an event that mentions them is queued behind it
+	assert.Nil(t, client.UserUpdated("user-1", 0, "", nil))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, client.CustomEvent("merge_reviewed", 0, "", copilot.CustomEventPayload{
+		"thing_id":    "thing-1",
+		"merged_from": "user-1",
+	}))
+
+	erased := make(chan *copilot.ErasureRecord)
+	go func() {
+		record, err := client.EraseUser(context.Background(), "user-1")
+		assert.Nil(t, err)
+		erased <- record
+	}()
+
+	// nothing is sent for the erasure until the event in flight is
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, sink.sink.Records())
+	close(sink.release)
+	record := <-erased
+	assert.Equal(t, 1, record.QueuedEventsPurged)
+
+	records := sink.sink.Records()
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, copilot.EventTypeUserUpdated, records[0].Events[0].Type)
+		assert.NotNil(t, records[1].Consent)
+		assert.Equal(t, copilot.EventTypeUserDeleted, records[2].Events[0].Type)
+	}
+}
@@ -1,8 +1,11 @@
 package copilot
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -15,43 +18,147 @@ type Event struct {
 	Payload   interface{} `json:"payload"`
 }
 
-func (event *Event) processDefaults() {
+func (event *Event) processDefaults(now time.Time) {
 	if event.Timestamp == 0 {
-		event.Timestamp = time.Now().UnixMilli()
+		event.Timestamp = now.UnixMilli()
 	}
 }
 
 // sendEvent takes the event and sends it to copilot, checking for errors; this consolidates
 // the general collect event call checks
-func (event *Event) sendEvent() error {
-	event.processDefaults()
+func (client *Client) sendEvent(event *Event) error {
+	config := client.configuration()
+	if config == nil {
+		return errors.New("copilot client not configured")
+	}
+	event.processDefaults(config.now())
+	if client != nil && client.immediate {
+		return config.sender.do(func() error {
+			return client.collectEvent(event)
+		})
+	}
+	return config.sender.send(client, *event)
+}
 
-	eventRequest := eventRequest{
-		Events: []Event{
-			*event,
-		},
+// collectEvent delivers the event, adding it to the dead letter store if Copilot rejects it
+func (client *Client) collectEvent(event *Event) error {
+	config := client.configuration()
+	err := client.deliverEvent(event)
+	var invalid *InvalidEventError
+	if errors.As(err, &invalid) {
+		config.addDeadLetter(*event, invalid)
 	}
-	response, eventError, err := makeCollectAPICall(eventRequest)
+	return err
+}
+
+// deliverEvent applies the privacy policy to the event and posts it
+func (client *Client) deliverEvent(event *Event) error {
+	rejected, err := client.deliverEvents([]Event{*event})
 	if err != nil {
 		return err
 	}
+	if invalid, found := rejected[0]; found {
+		return invalid
+	}
+	return nil
+}
+
+// deliverEvents applies the privacy policy to the events and posts them together in a single request, in order.
+// The error for each event Copilot rejected is returned by its index.
+func (client *Client) deliverEvents(events []Event) (map[int]*InvalidEventError, error) {
+	config := client.configuration()
+
+	sent := make([]Event, len(events))
+	copy(sent, events)
+	if config != nil {
+		for i := range sent {
+			var err error
+			sent[i], err = config.PrivacyPolicy.apply(sent[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	eventRequest := eventRequest{
+		Events: sent,
+	}
+	response, eventError, err := makeCollectAPICall(config, eventRequest)
+	if err != nil {
+		return nil, err
+	}
 	if eventError != nil {
-		return eventError
+		return nil, eventError
 	}
 	if response == nil {
-		return errors.New("invalid client request")
-	}
-	if len(response.InvalidEvents) > 0 {
-		// find the corresponding event error and return it
-		// it should usually only be one, but in case they somehow got batched, it's
-		// best to verify
-		for _, ie := range response.InvalidEvents {
-			if ie.EventID == event.EventID {
-				return &ie
+		return nil, errors.New("invalid client request")
+	}
+	// match each invalid event to the event it came from; the IDs are checked since the
+	// index may not be reliable if Copilot reorders them
+	rejected := map[int]*InvalidEventError{}
+	for _, ie := range response.InvalidEvents {
+		for i := range sent {
+			if sent[i].EventID == ie.EventID {
+				invalid := ie
+				invalid.Endpoint = response.Endpoint
+				rejected[i] = &invalid
+				break
 			}
 		}
 	}
-	return nil
+	return rejected, nil
+}
+
+// sendEvents delivers the events together in a single request, in order, dead lettering any that Copilot
+// rejects. Batches are always sent directly, even when background sending is enabled, so that the caller
+// knows which events were accepted.
+func (client *Client) sendEvents(events []Event) (map[int]*InvalidEventError, error) {
+	config := client.configuration()
+	if config == nil {
+		return nil, errors.New("copilot client not configured")
+	}
+	now := config.now()
+	for i := range events {
+		events[i].processDefaults(now)
+	}
+	var rejected map[int]*InvalidEventError
+	err := config.sender.do(func() error {
+		var err error
+		rejected, err = client.deliverEvents(events)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, invalid := range rejected {
+		config.addDeadLetter(events[i], invalid)
+	}
+	return rejected, nil
+}
+
+// BatchError is returned when Copilot rejected some of the events that were sent together in a single request.
+// The other events were accepted.
+type BatchError struct {
+	Events []Event
+	// Rejected is the error for each rejected event, by its index in Events
+	Rejected map[int]*InvalidEventError
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d events were rejected, the first with: %v", len(err.Rejected), len(err.Events), err.Unwrap())
+}
+
+// Unwrap returns the error for the first rejected event
+func (err *BatchError) Unwrap() error {
+	indexes := make([]int, 0, len(err.Rejected))
+	for index := range err.Rejected {
+		indexes = append(indexes, index)
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+	sort.Ints(indexes)
+	return err.Rejected[indexes[0]]
 }
 
 // eventRequest is the request that is sent to the collect API
@@ -64,6 +171,8 @@ type eventRequest struct {
 // InvalidEvents slice is 0
 type EventResponse struct {
 	InvalidEvents []InvalidEventError `json:"invalid_events"`
+	// Endpoint is the collect endpoint that responded
+	Endpoint string `json:"-"`
 }
 
 // InvalidEventError represents an invalid event error returned from Copilot's collect API
@@ -71,6 +180,8 @@ type InvalidEventError struct {
 	EventID    string `json:"event_id"`
 	Index      int    `json:"index"`
 	EventError string `json:"error"`
+	// Endpoint is the collect endpoint that rejected the event
+	Endpoint string `json:"-"`
 }
 
 func (err *InvalidEventError) Error() string {
@@ -82,6 +193,8 @@ func (err *InvalidEventError) Error() string {
 type EventResponseError struct {
 	ErrorMessage string `json:"error_message"`
 	Reason       string `json:"reason"`
+	// Endpoint is the collect endpoint that returned the error
+	Endpoint string `json:"-"`
 }
 
 func (err *EventResponseError) Error() string {
@@ -90,7 +203,7 @@ func (err *EventResponseError) Error() string {
 
 func eventIDHelper(eventType, key string, timestamp int64) string {
 	if timestamp == 0 {
-		timestamp = time.Now().UnixMilli()
+		timestamp = now().UnixMilli()
 	}
 	id := fmt.Sprintf("%s-%s-%d", eventType, key, timestamp)
 
@@ -100,3 +213,22 @@ func eventIDHelper(eventType, key string, timestamp int64) string {
 	}
 	return id
 }
+
+// uniqueEventID builds an ID for an event that is sent alongside others for the same thing or user, which
+// eventIDHelper could give the same ID once it is cut to 50 characters. It starts with the type and first key,
+// and ends with a short hash of the type, timestamp and every key.
+func uniqueEventID(eventType string, timestamp int64, keys ...string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%d", eventType, timestamp)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "\x00%s", key)
+	}
+	prefix := eventType
+	if len(keys) > 0 {
+		prefix += "-" + keys[0]
+	}
+	if len(prefix) > 37 {
+		prefix = prefix[0:37]
+	}
+	return prefix + "-" + hex.EncodeToString(hash.Sum(nil))[0:12]
+}
@@ -0,0 +1,41 @@
+package copilot
+
+import "reflect"
+
+// SaveConfig returns a function that restores the current configuration, so that tests can call Setup
+// without affecting the tests that run after them
+func SaveConfig() func() {
+	saved := config
+	return func() {
+		config = saved
+	}
+}
+
+// ConfiguredClient returns a client bound to the current configuration, which keeps using it after Setup is
+// called again
+func ConfiguredClient() *Client {
+	return &Client{config: config}
+}
+
+// SaveCustomEvents returns a function that restores the registered custom events and strict mode, so that tests
+// can register the same types every time they run
+func SaveCustomEvents() func() {
+	customEventRegistry.Lock()
+	defer customEventRegistry.Unlock()
+	bySubtype := map[string]*customEventSchema{}
+	for subtype, schema := range customEventRegistry.bySubtype {
+		bySubtype[subtype] = schema
+	}
+	byType := map[reflect.Type]*customEventSchema{}
+	for typ, schema := range customEventRegistry.byType {
+		byType[typ] = schema
+	}
+	strict := customEventRegistry.strict
+	return func() {
+		customEventRegistry.Lock()
+		defer customEventRegistry.Unlock()
+		customEventRegistry.bySubtype = bySubtype
+		customEventRegistry.byType = byType
+		customEventRegistry.strict = strict
+	}
+}
@@ -0,0 +1,229 @@
+package copilot
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// below are the defaults used by the FirmwareUpgradeTracker when an upgrade times out
+const (
+	FirmwareUpgradeStatusKey      = "firmware_upgrade"
+	FirmwareUpgradeStatusTimedOut = "timed_out"
+)
+
+// FirmwareUpgrade is an upgrade that has been started but not yet completed
+type FirmwareUpgrade struct {
+	ThingID     string `json:"thing_id"`
+	UserID      string `json:"user_id,omitempty"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"`
+	// StartedAt is the Unix timestamp in milliseconds of when the upgrade started
+	StartedAt int64 `json:"started_at"`
+}
+
+// FirmwareUpgradeTrackerConfig configures a FirmwareUpgradeTracker
+type FirmwareUpgradeTrackerConfig struct {
+	// Timeout is how long to wait for a completion before the upgrade is considered failed. If 0, upgrades never time out.
+	Timeout time.Duration
+	// FailureSubtype, if set, sends a custom event with this subtype when an upgrade times out. Otherwise, a
+	// ThingStatusChanged event is sent with the StatusKey and a value of timed_out.
+	FailureSubtype string
+	// StatusKey is the status key used for timeouts; it defaults to FirmwareUpgradeStatusKey
+	StatusKey string
+	// OnError is called with any errors sending the timeout events, since they happen in the background. It
+	// defaults to logging the error.
+	OnError func(error)
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+}
+
+// FirmwareUpgradeTracker links ThingFirmwareUpgradeStarted and ThingFirmwareUpgradeCompleted calls for a thing so
+// that the completed event includes the duration and versions of the upgrade, and so that upgrades which never
+// complete are reported to Copilot.
+type FirmwareUpgradeTracker struct {
+	config FirmwareUpgradeTrackerConfig
+
+	lock     sync.Mutex
+	upgrades map[string]*trackedFirmwareUpgrade
+}
+
+// trackedFirmwareUpgrade is a pending upgrade along with its timeout timer
+type trackedFirmwareUpgrade struct {
+	upgrade FirmwareUpgrade
+	timer   *time.Timer
+}
+
+// NewFirmwareUpgradeTracker creates a new tracker with the provided configuration
+func NewFirmwareUpgradeTracker(config FirmwareUpgradeTrackerConfig) *FirmwareUpgradeTracker {
+	if config.StatusKey == "" {
+		config.StatusKey = FirmwareUpgradeStatusKey
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Printf("copilot firmware upgrade timeout could not be sent: %v", err)
+		}
+	}
+	return &FirmwareUpgradeTracker{
+		config:   config,
+		upgrades: map[string]*trackedFirmwareUpgrade{},
+	}
+}
+
+// Start calls ThingFirmwareUpgradeStarted and records the upgrade so it can be matched with its completion. If an
+// upgrade is already pending for the thing, it is replaced. The userID and versions are optional.
+func (tracker *FirmwareUpgradeTracker) Start(thingID, userID, fromVersion, toVersion string, timestamp int64) error {
+	if thingID == "" {
+		return errors.New("thingID cannot be blank")
+	}
+	timestamp, err := tracker.config.Client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	additional := map[string]interface{}{}
+	if fromVersion != "" {
+		additional["from_version"] = fromVersion
+	}
+	err = tracker.config.Client.thingFirmwareUpgradeEvent(EventTypeThingFirmwareUpgradeStarted, thingID, userID, toVersion, timestamp, "", additional)
+	if err != nil {
+		return err
+	}
+
+	tracked := &trackedFirmwareUpgrade{
+		upgrade: FirmwareUpgrade{
+			ThingID:     thingID,
+			UserID:      userID,
+			FromVersion: fromVersion,
+			ToVersion:   toVersion,
+			StartedAt:   timestamp,
+		},
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if existing, found := tracker.upgrades[thingID]; found && existing.timer != nil {
+		existing.timer.Stop()
+	}
+	if tracker.config.Timeout > 0 {
+		tracked.timer = time.AfterFunc(tracker.config.Timeout, func() {
+			tracker.timeout(tracked)
+		})
+	}
+	tracker.upgrades[thingID] = tracked
+	return nil
+}
+
+// Complete calls ThingFirmwareUpgradeCompleted for the thing. If a started upgrade is pending, the payload also
+// includes the from_version, to_version, started_at and duration_ms of the upgrade. If the firmwareVersion is
+// blank, the version the upgrade was started with is used.
+func (tracker *FirmwareUpgradeTracker) Complete(thingID, firmwareVersion string, timestamp int64) error {
+	if thingID == "" {
+		return errors.New("thingID cannot be blank")
+	}
+	timestamp, err := tracker.config.Client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
+	tracker.lock.Lock()
+	tracked, found := tracker.upgrades[thingID]
+	if found {
+		delete(tracker.upgrades, thingID)
+		if tracked.timer != nil {
+			tracked.timer.Stop()
+		}
+	}
+	tracker.lock.Unlock()
+
+	if !found {
+		return tracker.config.Client.ThingFirmwareUpgradeCompleted(thingID, "", firmwareVersion, timestamp, "")
+	}
+
+	upgrade := tracked.upgrade
+	if firmwareVersion == "" {
+		firmwareVersion = upgrade.ToVersion
+	}
+	additional := map[string]interface{}{
+		"started_at":  upgrade.StartedAt,
+		"duration_ms": timestamp - upgrade.StartedAt,
+	}
+	if upgrade.FromVersion != "" {
+		additional["from_version"] = upgrade.FromVersion
+	}
+	if firmwareVersion != "" {
+		additional["to_version"] = firmwareVersion
+	}
+	return tracker.config.Client.thingFirmwareUpgradeEvent(EventTypeThingFirmwareUpgradeCompleted, thingID, upgrade.UserID, firmwareVersion, timestamp, "", additional)
+}
+
+// Pending returns the upgrades that have started but not completed or timed out, ordered by when they started
+func (tracker *FirmwareUpgradeTracker) Pending() []FirmwareUpgrade {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	pending := make([]FirmwareUpgrade, 0, len(tracker.upgrades))
+	for _, tracked := range tracker.upgrades {
+		pending = append(pending, tracked.upgrade)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].StartedAt < pending[j].StartedAt
+	})
+	return pending
+}
+
+// Stop cancels all of the pending timeouts. Pending upgrades are kept and can still be completed.
+func (tracker *FirmwareUpgradeTracker) Stop() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	for _, tracked := range tracker.upgrades {
+		if tracked.timer != nil {
+			tracked.timer.Stop()
+		}
+	}
+}
+
+// timeout is called when a pending upgrade has not completed within the timeout
+func (tracker *FirmwareUpgradeTracker) timeout(tracked *trackedFirmwareUpgrade) {
+	upgrade := tracked.upgrade
+	tracker.lock.Lock()
+	current, found := tracker.upgrades[upgrade.ThingID]
+	if !found || current != tracked {
+		// it was completed or replaced in the meantime
+		tracker.lock.Unlock()
+		return
+	}
+	delete(tracker.upgrades, upgrade.ThingID)
+	tracker.lock.Unlock()
+
+	timestamp := tracker.config.Client.now().UnixMilli()
+	var err error
+	if tracker.config.FailureSubtype != "" {
+		payload := CustomEventPayload{
+			"thing_id":   upgrade.ThingID,
+			"started_at": upgrade.StartedAt,
+			"timeout_ms": tracker.config.Timeout.Milliseconds(),
+		}
+		if upgrade.UserID != "" {
+			payload["user_id"] = upgrade.UserID
+		}
+		if upgrade.FromVersion != "" {
+			payload["from_version"] = upgrade.FromVersion
+		}
+		if upgrade.ToVersion != "" {
+			payload["to_version"] = upgrade.ToVersion
+		}
+		err = tracker.config.Client.CustomEvent(tracker.config.FailureSubtype, timestamp, "", payload)
+	} else {
+		payload := &ThingStatusChangedPayload{
+			StatusKey:   String(tracker.config.StatusKey),
+			StatusValue: String(FirmwareUpgradeStatusTimedOut),
+		}
+		if upgrade.UserID != "" {
+			payload.UserID = String(upgrade.UserID)
+		}
+		err = tracker.config.Client.ThingStatusChanged(upgrade.ThingID, timestamp, "", payload)
+	}
+	if err != nil {
+		tracker.config.OnError(err)
+	}
+}
@@ -0,0 +1,116 @@
+package copilot_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirmwareUpgradeTracker(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	timestamp := time.Now().UnixMilli()
+
+	tracker := copilot.NewFirmwareUpgradeTracker(copilot.FirmwareUpgradeTrackerConfig{
+		Timeout: time.Hour,
+		Client:  recorder.Client,
+	})
+	defer tracker.Stop()
+
+	// make sure the thingID is set
+	err := tracker.Start("", "user-1", "1.0.0", "1.1.0", timestamp)
+	assert.NotNil(t, err)
+	err = tracker.Complete("", "1.1.0", timestamp)
+	assert.NotNil(t, err)
+	assert.Empty(t, tracker.Pending())
+	assert.Empty(t, recorder.Records())
+
+	err = tracker.Start("thing-1", "user-1", "1.0.0", "1.1.0", timestamp)
+	assert.Nil(t, err)
+	pending := tracker.Pending()
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "1.0.0", pending[0].FromVersion)
+		assert.Equal(t, "1.1.0", pending[0].ToVersion)
+	}
+	recorder.AssertEmitted(t, copilot.EventTypeThingFirmwareUpgradeStarted, "user-1", map[string]interface{}{
+		"thing_id":         "thing-1",
+		"firmware_version": "1.1.0",
+		"from_version":     "1.0.0",
+	})
+
+	// the completion has the duration and versions of the upgrade
+	err = tracker.Complete("thing-1", "", timestamp+60000)
+	assert.Nil(t, err)
+	assert.Empty(t, tracker.Pending())
+	recorder.AssertEmitted(t, copilot.EventTypeThingFirmwareUpgradeCompleted, "user-1", map[string]interface{}{
+		"thing_id":         "thing-1",
+		"firmware_version": "1.1.0",
+		"from_version":     "1.0.0",
+		"to_version":       "1.1.0",
+		"started_at":       timestamp,
+		"duration_ms":      60000,
+	})
+}
+
+func TestFirmwareUpgradeTrackerTimeout(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	errs := make(chan error, 2)
+	tracker := copilot.NewFirmwareUpgradeTracker(copilot.FirmwareUpgradeTrackerConfig{
+		Timeout:        20 * time.Millisecond,
+		FailureSubtype: "firmware_upgrade_failed",
+		Client:         recorder.Client,
+		OnError: func(err error) {
+			errs <- err
+		},
+	})
+	defer tracker.Stop()
+
+	timestamp := time.Now().UnixMilli()
+	assert.Nil(t, tracker.Start("thing-1", "user-1", "1.0.0", "1.1.0", timestamp))
+	event, found := recorder.WaitFor(copilot.EventTypeCustomEvent, "user-1", time.Second)
+	if assert.True(t, found) {
+		payload, err := copilottest.Payload[map[string]interface{}](event)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"subtype":      "firmware_upgrade_failed",
+			"thing_id":     "thing-1",
+			"user_id":      "user-1",
+			"from_version": "1.0.0",
+			"to_version":   "1.1.0",
+			"started_at":   float64(timestamp),
+			"timeout_ms":   float64(20),
+		}, payload)
+	}
+	assert.Empty(t, tracker.Pending())
+	assert.Empty(t, recorder.EventsOfType(copilot.EventTypeThingStatusChanged))
+
+	// a completion after the timeout is sent without the upgrade's details
+	recorder.Reset()
+	assert.Nil(t, tracker.Complete("thing-1", "1.1.0", timestamp+60000))
+	completed, err := copilottest.Payload[map[string]interface{}](recorder.Events()[0])
+	assert.Nil(t, err)
+	assert.NotContains(t, completed, "duration_ms")
+
+	// without a failure subtype, the thing's status is changed instead
+	tracker = copilot.NewFirmwareUpgradeTracker(copilot.FirmwareUpgradeTrackerConfig{
+		Timeout: 20 * time.Millisecond,
+		Client:  recorder.Client,
+		OnError: func(err error) {
+			errs <- err
+		},
+	})
+	defer tracker.Stop()
+	recorder.Reset()
+	assert.Nil(t, tracker.Start("thing-2", "user-2", "", "2.0.0", timestamp))
+	_, found = recorder.WaitFor(copilot.EventTypeThingStatusChanged, "user-2", time.Second)
+	assert.True(t, found)
+	recorder.AssertEmitted(t, copilot.EventTypeThingStatusChanged, "user-2", map[string]interface{}{
+		"thing_id":     "thing-2",
+		"status_key":   copilot.FirmwareUpgradeStatusKey,
+		"status_value": copilot.FirmwareUpgradeStatusTimedOut,
+	})
+	assert.Empty(t, recorder.EventsOfType(copilot.EventTypeCustomEvent))
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,334 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// below are the roles of group members, sent as the role of each association
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleMember = "member"
+)
+
+// Group is a named set of users who share things, such as a household
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Members is the role of each user in the group
+	Members map[string]string `json:"members"`
+	// Things is the set of things shared by the group
+	Things map[string]bool `json:"things"`
+}
+
+// copyGroup returns a deep copy of the group
+func copyGroup(group Group) Group {
+	copied := Group{
+		ID:      group.ID,
+		Name:    group.Name,
+		Members: map[string]string{},
+		Things:  map[string]bool{},
+	}
+	for userID, role := range group.Members {
+		copied.Members[userID] = role
+	}
+	for thingID := range group.Things {
+		copied.Things[thingID] = true
+	}
+	return copied
+}
+
+// GroupStore holds the groups for a GroupManager. Implement it to persist the groups across restarts or to
+// share them between processes.
+type GroupStore interface {
+	// GetGroup returns the group, or nil if it does not exist
+	GetGroup(groupID string) (*Group, error)
+	SaveGroup(group Group) error
+	DeleteGroup(groupID string) error
+}
+
+// MemoryGroupStore is an in-memory GroupStore and the default used by the GroupManager
+type MemoryGroupStore struct {
+	lock   sync.RWMutex
+	groups map[string]Group
+}
+
+// NewMemoryGroupStore creates an empty in-memory group store
+func NewMemoryGroupStore() *MemoryGroupStore {
+	return &MemoryGroupStore{
+		groups: map[string]Group{},
+	}
+}
+
+// GetGroup returns a copy of the group, or nil if it does not exist
+func (store *MemoryGroupStore) GetGroup(groupID string) (*Group, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	group, found := store.groups[groupID]
+	if !found {
+		return nil, nil
+	}
+	copied := copyGroup(group)
+	return &copied, nil
+}
+
+// SaveGroup stores a copy of the group
+func (store *MemoryGroupStore) SaveGroup(group Group) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.groups[group.ID] = copyGroup(group)
+	return nil
+}
+
+// DeleteGroup removes the group
+func (store *MemoryGroupStore) DeleteGroup(groupID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.groups, groupID)
+	return nil
+}
+
+// GroupManager keeps the associations of groups of users who share things, such as a household, in step with
+// Copilot. Adding a member associates them to every shared thing, adding a thing associates it to every member,
+// and removing either disassociates them, so only the associations that changed are sent. Each association has
+// the group_id and the member's role. The events for each change are sent together in a single request, one
+// millisecond apart, and the group is only saved once the request is sent. If Copilot rejects some of them, the
+// group is still saved and a *BatchError is returned; the rejected events are dead lettered.
+type GroupManager struct {
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+
+	store GroupStore
+	lock  sync.Mutex
+}
+
+// NewGroupManager creates a new manager. If the store is nil, an in-memory store is used.
+func NewGroupManager(store GroupStore) *GroupManager {
+	if store == nil {
+		store = NewMemoryGroupStore()
+	}
+	return &GroupManager{
+		store: store,
+	}
+}
+
+// Group returns the group, or nil if it does not exist
+func (manager *GroupManager) Group(groupID string) (*Group, error) {
+	return manager.store.GetGroup(groupID)
+}
+
+// CreateGroup creates an empty group. Nothing is sent until members and things are added.
+func (manager *GroupManager) CreateGroup(groupID string, name string) error {
+	if groupID == "" {
+		return errors.New("groupID cannot be blank")
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	existing, err := manager.store.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("group %s already exists", groupID)
+	}
+	return manager.store.SaveGroup(Group{
+		ID:      groupID,
+		Name:    name,
+		Members: map[string]string{},
+		Things:  map[string]bool{},
+	})
+}
+
+// AddMember adds the user to the group with the role, which defaults to GroupRoleMember, and associates them to
+// every shared thing. If they are already a member with a different role, the associations are sent again with
+// the new role.
+func (manager *GroupManager) AddMember(groupID string, userID string, role string, timestamp int64) error {
+	if userID == "" {
+		return errors.New("userID cannot be blank")
+	}
+	if role == "" {
+		role = GroupRoleMember
+	}
+	if role != GroupRoleOwner && role != GroupRoleMember {
+		return fmt.Errorf("role must be %s or %s", GroupRoleOwner, GroupRoleMember)
+	}
+	return manager.update(groupID, timestamp, func(group *Group) []groupAssociation {
+		if current, found := group.Members[userID]; found && current == role {
+			return nil
+		}
+		group.Members[userID] = role
+		changes := []groupAssociation{}
+		for _, thingID := range sortedKeys(group.Things) {
+			changes = append(changes, groupAssociation{thingID: thingID, userID: userID, role: role, associated: true})
+		}
+		return changes
+	})
+}
+
+// RemoveMember removes the user from the group and disassociates them from every shared thing
+func (manager *GroupManager) RemoveMember(groupID string, userID string, timestamp int64) error {
+	return manager.update(groupID, timestamp, func(group *Group) []groupAssociation {
+		if _, found := group.Members[userID]; !found {
+			return nil
+		}
+		delete(group.Members, userID)
+		changes := []groupAssociation{}
+		for _, thingID := range sortedKeys(group.Things) {
+			changes = append(changes, groupAssociation{thingID: thingID, userID: userID})
+		}
+		return changes
+	})
+}
+
+// AddThing shares the thing with the group, associating it to every member with their role
+func (manager *GroupManager) AddThing(groupID string, thingID string, timestamp int64) error {
+	if thingID == "" {
+		return errors.New("thingID cannot be blank")
+	}
+	return manager.update(groupID, timestamp, func(group *Group) []groupAssociation {
+		if group.Things[thingID] {
+			return nil
+		}
+		group.Things[thingID] = true
+		changes := []groupAssociation{}
+		for _, userID := range sortedMembers(group.Members) {
+			changes = append(changes, groupAssociation{thingID: thingID, userID: userID, role: group.Members[userID], associated: true})
+		}
+		return changes
+	})
+}
+
+// RemoveThing stops sharing the thing with the group, disassociating it from every member, such as when it
+// leaves the household
+func (manager *GroupManager) RemoveThing(groupID string, thingID string, timestamp int64) error {
+	return manager.update(groupID, timestamp, func(group *Group) []groupAssociation {
+		if !group.Things[thingID] {
+			return nil
+		}
+		delete(group.Things, thingID)
+		changes := []groupAssociation{}
+		for _, userID := range sortedMembers(group.Members) {
+			changes = append(changes, groupAssociation{thingID: thingID, userID: userID})
+		}
+		return changes
+	})
+}
+
+// DeleteGroup disassociates every member from every shared thing and deletes the group
+func (manager *GroupManager) DeleteGroup(groupID string, timestamp int64) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	group, err := manager.store.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return nil
+	}
+	changes := []groupAssociation{}
+	for _, thingID := range sortedKeys(group.Things) {
+		for _, userID := range sortedMembers(group.Members) {
+			changes = append(changes, groupAssociation{thingID: thingID, userID: userID})
+		}
+	}
+	sendErr := manager.Client.sendGroupAssociations(group.ID, changes, timestamp)
+	var batchErr *BatchError
+	if sendErr != nil && !errors.As(sendErr, &batchErr) {
+		return sendErr
+	}
+	if err := manager.store.DeleteGroup(groupID); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// update applies the change to the group and sends the associations it returns, saving the group once they are sent
+func (manager *GroupManager) update(groupID string, timestamp int64, change func(group *Group) []groupAssociation) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	group, err := manager.store.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return fmt.Errorf("group %s does not exist", groupID)
+	}
+	changes := change(group)
+	sendErr := manager.Client.sendGroupAssociations(group.ID, changes, timestamp)
+	var batchErr *BatchError
+	if sendErr != nil && !errors.As(sendErr, &batchErr) {
+		return sendErr
+	}
+	if err := manager.store.SaveGroup(*group); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// groupAssociation is a single association or disassociation caused by a change to a group
+type groupAssociation struct {
+	thingID    string
+	userID     string
+	role       string
+	associated bool
+}
+
+// sendGroupAssociations sends the associations together in a single request, one millisecond apart, recording
+// the accepted ones in the association store
+func (client *Client) sendGroupAssociations(groupID string, changes []groupAssociation, timestamp int64) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	events := []Event{}
+	for index, change := range changes {
+		eventType := EventTypeThingDisassociated
+		if change.associated {
+			eventType = EventTypeThingAssociated
+		}
+		eventTimestamp := timestamp + int64(index)
+		event, err := client.associationEvent(eventType, change.thingID, change.userID, eventTimestamp,
+			uniqueEventID(eventType, eventTimestamp, change.thingID, change.userID))
+		if err != nil {
+			return err
+		}
+		payload := event.Payload.(map[string]string)
+		payload["group_id"] = groupID
+		if change.associated {
+			payload["role"] = change.role
+		}
+		events = append(events, event)
+	}
+
+	rejected, err := client.sendEvents(events)
+	if err != nil {
+		return err
+	}
+	for index, change := range changes {
+		if _, found := rejected[index]; !found {
+			if err := client.recordAssociation(change.thingID, change.userID, change.associated); err != nil {
+				return err
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		return &BatchError{
+			Events:   events,
+			Rejected: rejected,
+		}
+	}
+	return nil
+}
+
+// sortedMembers returns the user IDs of the members in order
+func sortedMembers(members map[string]string) []string {
+	set := map[string]bool{}
+	for userID := range members {
+		set[userID] = true
+	}
+	return sortedKeys(set)
+}
@@ -0,0 +1,101 @@
+package copilot_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupManager(t *testing.T) {
+	associations := copilot.NewMemoryAssociationStore()
+	recorder := copilottest.NewRecorder(copilot.WithAssociationStore(associations))
+	manager := copilot.NewGroupManager(nil)
+	manager.Client = recorder.Client
+
+	assert.Nil(t, manager.CreateGroup("home-1", "The Smiths"))
+	assert.NotNil(t, manager.CreateGroup("home-1", "The Smiths"))
+	assert.NotNil(t, manager.AddMember("home-2", "user-1", "", 0))
+
+	// nothing is shared yet, so adding members sends nothing
+	assert.Nil(t, manager.AddMember("home-1", "user-1", copilot.GroupRoleOwner, 0))
+	assert.Nil(t, manager.AddMember("home-1", "user-2", "", 0))
+	assert.NotNil(t, manager.AddMember("home-1", "user-3", "admin", 0))
+	assert.Empty(t, recorder.Records())
+
+	// a thing is associated to every member in one request
+	assert.Nil(t, manager.AddThing("home-1", "thing-1", 0))
+	assert.Len(t, recorder.Records(), 1)
+	recorder.AssertEmitted(t, copilot.EventTypeThingAssociated, "user-1", map[string]interface{}{"thing_id": "thing-1", "group_id": "home-1", "role": "owner"})
+	recorder.AssertEmitted(t, copilot.EventTypeThingAssociated, "user-2", map[string]interface{}{"thing_id": "thing-1", "role": "member"})
+	assert.Nil(t, manager.AddThing("home-1", "thing-2", 0))
+
+	// adding them again sends nothing
+	recorder.Reset()
+	assert.Nil(t, manager.AddThing("home-1", "thing-1", 0))
+	assert.Nil(t, manager.AddMember("home-1", "user-2", copilot.GroupRoleMember, 0))
+	assert.Empty(t, recorder.Records())
+
+	// a new member is associated to every thing, and a role change is sent again
+	assert.Nil(t, manager.AddMember("home-1", "user-3", "", 0))
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeThingAssociated), 2)
+	assert.Nil(t, manager.AddMember("home-1", "user-2", copilot.GroupRoleOwner, 0))
+	recorder.AssertEmitted(t, copilot.EventTypeThingAssociated, "user-2", map[string]interface{}{"thing_id": "thing-2", "role": "owner"})
+	group, err := manager.Group("home-1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"user-1": "owner", "user-2": "owner", "user-3": "member"}, group.Members)
+
+	// removing a member or a thing disassociates only those
+	recorder.Reset()
+	assert.Nil(t, manager.RemoveMember("home-1", "user-3", 0))
+	assert.Len(t, recorder.UserEvents(copilot.EventTypeThingDisassociated, "user-3"), 2)
+	assert.Nil(t, manager.RemoveThing("home-1", "thing-1", 0))
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeThingDisassociated), 4)
+	users, err := associations.UsersForThing("thing-1")
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+	users, err = associations.UsersForThing("thing-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-1", "user-2"}, users)
+
+	// a failed request leaves the group unchanged
+	recorder.FailNext(errors.New("copilot is down"))
+	assert.NotNil(t, manager.AddThing("home-1", "thing-3", 0))
+	group, err = manager.Group("home-1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{"thing-2": true}, group.Things)
+
+	// deleting the group disassociates everything
+	recorder.Reset()
+	assert.Nil(t, manager.DeleteGroup("home-1", 0))
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeThingDisassociated), 2)
+	group, err = manager.Group("home-1")
+	assert.Nil(t, err)
+	assert.Nil(t, group)
+	things, err := associations.ThingsForUser("user-1")
+	assert.Nil(t, err)
+	assert.Empty(t, things)
+}
+
+func TestGroupManagerEventIDs(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	manager := copilot.NewGroupManager(nil)
+	manager.Client = recorder.Client
+	assert.Nil(t, manager.CreateGroup("home-1", ""))
+	for _, userID := range []string{"user-1", "user-2", "user-3"} {
+		assert.Nil(t, manager.AddMember("home-1", userID, "", 0))
+	}
+
+	// the events for a thing with a long ID keep distinct event IDs within the 50 character limit
+	assert.Nil(t, manager.AddThing("home-1", "3f2b8c1e-9a4d-4c1b-8e2f-123456789abc", 0))
+	events := recorder.Events()
+	assert.Len(t, events, 3)
+	ids := map[string]bool{}
+	for _, event := range events {
+		assert.LessOrEqual(t, len(event.EventID), 50)
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, 3)
+}
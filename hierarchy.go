@@ -0,0 +1,182 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// HierarchyStore holds the parent of each thing, such as the hub a sensor is connected through. When one is
+// configured with WithThingHierarchy, the parent_thing_id of ThingCreated and ThingUpdated is recorded in it, and
+// filled in from it when not set. Implement it to keep the hierarchy in a database.
+type HierarchyStore interface {
+	// SetParent records the parent of the thing, replacing any previous one. It returns an error if the parent is
+	// the thing itself or one of its descendants.
+	SetParent(thingID string, parentID string) error
+	RemoveParent(thingID string) error
+	// Parent returns the ID of the thing's parent, or blank if it has none
+	Parent(thingID string) (string, error)
+	// Children returns the IDs of the thing's direct children, sorted
+	Children(thingID string) ([]string, error)
+}
+
+// WithThingHierarchy records the parent of each thing in the store
+func WithThingHierarchy(store HierarchyStore) Option {
+	return func(config *configStruct) {
+		config.Hierarchy = store
+	}
+}
+
+// MemoryHierarchyStore is an in-memory HierarchyStore
+type MemoryHierarchyStore struct {
+	lock     sync.RWMutex
+	parents  map[string]string
+	children map[string]map[string]bool
+}
+
+// NewMemoryHierarchyStore creates an empty in-memory hierarchy store
+func NewMemoryHierarchyStore() *MemoryHierarchyStore {
+	return &MemoryHierarchyStore{
+		parents:  map[string]string{},
+		children: map[string]map[string]bool{},
+	}
+}
+
+// SetParent records the parent of the thing, replacing any previous one
+func (store *MemoryHierarchyStore) SetParent(thingID string, parentID string) error {
+	if thingID == "" || parentID == "" {
+		return errors.New("thingID and parentID cannot be blank")
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	for ancestor := parentID; ancestor != ""; ancestor = store.parents[ancestor] {
+		if ancestor == thingID {
+			return fmt.Errorf("%s cannot be the parent of %s since it is one of its descendants", parentID, thingID)
+		}
+	}
+	store.removeParent(thingID)
+	store.parents[thingID] = parentID
+	if store.children[parentID] == nil {
+		store.children[parentID] = map[string]bool{}
+	}
+	store.children[parentID][thingID] = true
+	return nil
+}
+
+// RemoveParent removes the parent of the thing, if it has one
+func (store *MemoryHierarchyStore) RemoveParent(thingID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.removeParent(thingID)
+	return nil
+}
+
+// removeParent removes the parent of the thing; the lock must be held
+func (store *MemoryHierarchyStore) removeParent(thingID string) {
+	parentID, found := store.parents[thingID]
+	if !found {
+		return
+	}
+	delete(store.parents, thingID)
+	delete(store.children[parentID], thingID)
+	if len(store.children[parentID]) == 0 {
+		delete(store.children, parentID)
+	}
+}
+
+// Parent returns the ID of the thing's parent, or blank if it has none
+func (store *MemoryHierarchyStore) Parent(thingID string) (string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.parents[thingID], nil
+}
+
+// Children returns the IDs of the thing's direct children, sorted
+func (store *MemoryHierarchyStore) Children(thingID string) ([]string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return sortedKeys(store.children[thingID]), nil
+}
+
+// thingDescendants returns the children of the thing, then their children, and so on
+func thingDescendants(store HierarchyStore, thingID string) ([]string, error) {
+	descendants := []string{}
+	seen := map[string]bool{thingID: true}
+	next := []string{thingID}
+	for len(next) > 0 {
+		parentID := next[0]
+		next = next[1:]
+		children, err := store.Children(parentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, childID := range children {
+			if seen[childID] {
+				continue
+			}
+			seen[childID] = true
+			descendants = append(descendants, childID)
+			next = append(next, childID)
+		}
+	}
+	return descendants, nil
+}
+
+// resolveParent fills in the payload's parent from the hierarchy store when it is not set, and checks that a
+// parent that is set can be recorded
+func (client *Client) resolveParent(thingID string, payload *ThingCreatedUpdatedPayload) error {
+	config := client.configuration()
+	if payload.ParentThingID != nil && *payload.ParentThingID == thingID {
+		return errors.New("a thing cannot be its own parent")
+	}
+	if config == nil || config.Hierarchy == nil {
+		return nil
+	}
+	if payload.ParentThingID == nil {
+		parentID, err := config.Hierarchy.Parent(thingID)
+		if err != nil {
+			return err
+		}
+		if parentID != "" {
+			payload.ParentThingID = &parentID
+		}
+		return nil
+	}
+	// walk up from the new parent so a cycle is caught before the event is sent, stopping if the store already
+	// has one among the ancestors
+	visited := map[string]bool{}
+	for ancestor := *payload.ParentThingID; ancestor != ""; {
+		if visited[ancestor] {
+			return fmt.Errorf("the hierarchy store has a cycle at %s", ancestor)
+		}
+		visited[ancestor] = true
+		parentID, err := config.Hierarchy.Parent(ancestor)
+		if err != nil {
+			return err
+		}
+		if parentID == thingID {
+			return fmt.Errorf("%s cannot be the parent of %s since it is one of its descendants", *payload.ParentThingID, thingID)
+		}
+		ancestor = parentID
+	}
+	return nil
+}
+
+// recordParent updates the hierarchy store, if there is one, after a thing event with a parent was sent. A blank
+// parent removes the thing's parent.
+func (client *Client) recordParent(thingID string, payload *ThingCreatedUpdatedPayload) error {
+	config := client.configuration()
+	if config == nil || config.Hierarchy == nil || payload.ParentThingID == nil {
+		return nil
+	}
+	var err error
+	if *payload.ParentThingID == "" {
+		err = config.Hierarchy.RemoveParent(thingID)
+	} else {
+		err = config.Hierarchy.SetParent(thingID, *payload.ParentThingID)
+	}
+	if err != nil {
+		return fmt.Errorf("the event was sent but the hierarchy store could not be updated: %w", err)
+	}
+	return nil
+}
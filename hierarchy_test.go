@@ -0,0 +1,192 @@
+package copilot_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThingHierarchy(t *testing.T) {
+	hierarchy := copilot.NewMemoryHierarchyStore()
+	recorder := copilottest.NewRecorder(copilot.WithThingHierarchy(hierarchy))
+
+	// the parent is recorded when a thing is created with one
+	assert.Nil(t, recorder.ThingCreated("hub-1", 0, "", nil))
+	assert.Nil(t, recorder.ThingCreated("sensor-1", 0, "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("hub-1")}))
+	assert.Nil(t, recorder.ThingCreated("sensor-2", 0, "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("sensor-1")}))
+	children, err := hierarchy.Children("hub-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sensor-1"}, children)
+
+	// and filled in from the store when it is not set
+	recorder.Reset()
+	assert.Nil(t, recorder.ThingUpdated("sensor-2", 0, "", &copilot.ThingCreatedUpdatedPayload{Model: copilot.String("temp-1")}))
+	updated, err := copilottest.Payload[copilot.ThingCreatedUpdatedPayload](recorder.Events()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "sensor-1", *updated.ParentThingID)
+
+	// cycles are rejected before anything is sent
+	recorder.Reset()
+	assert.NotNil(t, recorder.ThingUpdated("hub-1", 0, "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("sensor-2")}))
+	assert.NotNil(t, recorder.ThingUpdated("hub-1", 0, "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("hub-1")}))
+	assert.Empty(t, recorder.Records())
+	assert.NotNil(t, hierarchy.SetParent("hub-1", "sensor-2"))
+
+	// a blank parent removes it
+	assert.Nil(t, recorder.ThingUpdated("sensor-2", 0, "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("")}))
+	parentID, err := hierarchy.Parent("sensor-2")
+	assert.Nil(t, err)
+	assert.Empty(t, parentID)
+}
+
+func TestThingHierarchyPseudonyms(t *testing.T) {
+	policy := copilot.PrivacyPolicy{
+		PseudonymKey: copilot.RotatingPseudonymKey([]byte("pseudonym-key"), 24*time.Hour),
+	}
+	hierarchy := copilot.NewMemoryHierarchyStore()
+	recorder := copilottest.NewRecorder(copilot.WithThingHierarchy(hierarchy), copilot.WithPrivacyPolicy(policy))
+	timestamp := time.UnixMilli(1600000000000)
+
+	// the parent is pseudonymized when it is sent, but recorded as is
+	assert.Nil(t, recorder.ThingCreated("sensor-1", timestamp.UnixMilli(), "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("hub-1")}))
+	created := recorder.Events()[0].Payload.(map[string]interface{})
+	assert.Equal(t, policy.Pseudonymize("sensor-1", timestamp), created["thing_id"])
+	assert.Equal(t, policy.Pseudonymize("hub-1", timestamp), created["parent_thing_id"])
+	parentID, err := hierarchy.Parent("sensor-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "hub-1", parentID)
+
+	// and so is the parent a status is cascaded from
+	recorder.Reset()
+	monitor := copilot.NewConnectivityMonitor(copilot.ConnectivityMonitorConfig{
+		CascadeToChildren: true,
+		Client:            recorder.Client,
+	})
+	defer monitor.Stop()
+	assert.Nil(t, monitor.Connected("hub-1", "", timestamp.UnixMilli()))
+	cascaded := recorder.Records()[2].Events[0].Payload.(map[string]interface{})
+	assert.Equal(t, policy.Pseudonymize("sensor-1", timestamp), cascaded["thing_id"])
+	assert.Equal(t, policy.Pseudonymize("hub-1", timestamp), cascaded["cascaded_from"])
+}
+
+func TestThingHierarchyStoreCycle(t *testing.T) {
+	// a store that already has a cycle among the ancestors returns an error instead of walking it forever
+	recorder := copilottest.NewRecorder(copilot.WithThingHierarchy(cyclicHierarchyStore{
+		"hub-1": "hub-2",
+		"hub-2": "hub-1",
+	}))
+	assert.NotNil(t, recorder.ThingUpdated("sensor-1", 0, "", &copilot.ThingCreatedUpdatedPayload{ParentThingID: copilot.String("hub-1")}))
+	assert.Empty(t, recorder.Records())
+}
+
+// cyclicHierarchyStore is a HierarchyStore with fixed parents that are not checked for cycles
+type cyclicHierarchyStore map[string]string
+
+func (store cyclicHierarchyStore) SetParent(thingID string, parentID string) error {
+	store[thingID] = parentID
+	return nil
+}
+
+func (store cyclicHierarchyStore) RemoveParent(thingID string) error {
+	delete(store, thingID)
+	return nil
+}
+
+func (store cyclicHierarchyStore) Parent(thingID string) (string, error) {
+	return store[thingID], nil
+}
+
+func (store cyclicHierarchyStore) Children(thingID string) ([]string, error) {
+	return nil, nil
+}
+
+func TestConnectivityCascade(t *testing.T) {
+	hierarchy := copilot.NewMemoryHierarchyStore()
+	assert.Nil(t, hierarchy.SetParent("sensor-1", "hub-1"))
+	assert.Nil(t, hierarchy.SetParent("sensor-2", "hub-1"))
+	assert.Nil(t, hierarchy.SetParent("sensor-3", "sensor-2"))
+	recorder := copilottest.NewRecorder(copilot.WithThingHierarchy(hierarchy))
+	sessions := []copilot.ConnectivitySession{}
+	monitor := copilot.NewConnectivityMonitor(copilot.ConnectivityMonitorConfig{
+		CascadeToChildren: true,
+		Client:            recorder.Client,
+		OnSessionEnded: func(session copilot.ConnectivitySession) {
+			sessions = append(sessions, session)
+		},
+	})
+	defer monitor.Stop()
+
+	// a child that connects on its own is not sent again
+	assert.Nil(t, monitor.Connected("sensor-1", "user-1", 1600000000000))
+	recorder.Reset()
+	assert.Nil(t, monitor.Connected("hub-1", "user-1", 1600000001000))
+	records := recorder.Records()
+	assert.Len(t, records, 3)
+	assert.Len(t, records[2].Events, 2)
+	assert.True(t, monitor.Online("sensor-3"))
+	status, err := copilottest.Payload[copilot.ThingStatusChangedPayload](records[2].Events[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "sensor-3", *status.ThingID)
+	assert.Equal(t, copilot.ConnectivityOnline, *status.StatusValue)
+	assert.Equal(t, "hub-1", *status.CascadedFrom)
+
+	// going offline ends every child's session in one request
+	recorder.Reset()
+	assert.Nil(t, monitor.Disconnected("hub-1", 1600000002000))
+	records = recorder.Records()
+	assert.Len(t, records, 2)
+	assert.Len(t, records[1].Events, 3)
+	assert.False(t, monitor.Online("sensor-1"))
+	assert.Len(t, sessions, 4)
+
+	// children with long IDs keep distinct event IDs
+	assert.Nil(t, hierarchy.SetParent("3f2b8c1e-9a4d-4c1b-8e2f-123456789abc", "hub-1"))
+	assert.Nil(t, hierarchy.SetParent("3f2b8c1e-9a4d-4c1b-8e2f-cba987654321", "hub-1"))
+	recorder.Reset()
+	assert.Nil(t, monitor.Connected("hub-1", "", 1600000002500))
+	ids := map[string]bool{}
+	for _, event := range recorder.Events() {
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, len(recorder.Events()))
+	assert.Nil(t, monitor.Disconnected("hub-1", 1600000002600))
+
+	// a failed cascade is reverted so the next transition of the parent tries again
+	sink := &cascadeFailingSink{
+		sink: copilot.NewMemorySink(),
+		fail: true,
+	}
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithThingHierarchy(hierarchy))
+	assert.Nil(t, err)
+	monitor = copilot.NewConnectivityMonitor(copilot.ConnectivityMonitorConfig{
+		CascadeToChildren: true,
+		Client:            client,
+	})
+	assert.NotNil(t, monitor.Connected("hub-1", "", 1600000003000))
+	assert.True(t, monitor.Online("hub-1"))
+	assert.False(t, monitor.Online("sensor-1"))
+	sink.fail = false
+	assert.Nil(t, monitor.Disconnected("hub-1", 1600000004000))
+	assert.Nil(t, monitor.Connected("hub-1", "", 1600000005000))
+	assert.True(t, monitor.Online("sensor-3"))
+	assert.Len(t, sink.sink.Records(), 6)
+}
+
+// cascadeFailingSink fails the requests with cascaded status changes while fail is set
+type cascadeFailingSink struct {
+	sink *copilot.MemorySink
+	fail bool
+}
+
+func (sink *cascadeFailingSink) Write(record copilot.DryRunRecord) error {
+	for _, event := range record.Events {
+		if payload, ok := event.Payload.(map[string]interface{}); ok && payload["cascaded_from"] != nil && sink.fail {
+			return errors.New("copilot is down")
+		}
+	}
+	return sink.sink.Write(record)
+}
@@ -0,0 +1,133 @@
+package copilot
+
+import (
+	"errors"
+)
+
+// MergeUsers tells Copilot that an anonymous user, such as one tracked on a device before sign up, is the real
+// user. In a single request, it moves each of the anonymous user's things in the association store to the real
+// user with a ThingDisassociated and ThingAssociated pair, sends UserUpdated for the real user with the payload,
+// and, if deleteAnonymous is true, sends UserDeleted for the anonymous user. The real user's events have a
+// merged_from field with the anonymous ID. Each event is one millisecond after the one before it so the order
+// also holds when sorted by time. Once the request is sent, any events still queued for the anonymous user are
+// rewritten for the real one. If Copilot rejects any of the events, a *BatchError is returned.
+//
+// Without an association store, no things are moved.
+func MergeUsers(anonymousID string, realID string, timestamp int64, payload *UserEventPayload, deleteAnonymous bool) error {
+	return DefaultClient().MergeUsers(anonymousID, realID, timestamp, payload, deleteAnonymous)
+}
+
+// MergeUsers is the same as the package level MergeUsers, using the client's configuration
+func (client *Client) MergeUsers(anonymousID string, realID string, timestamp int64, payload *UserEventPayload, deleteAnonymous bool) error {
+	// basic error checking and set some defaults
+	if anonymousID == "" || realID == "" {
+		return errors.New("anonymousID and realID cannot be blank")
+	}
+	if anonymousID == realID {
+		return errors.New("anonymousID and realID cannot be the same")
+	}
+	config := client.configuration()
+	if config == nil {
+		return errors.New("copilot client not configured")
+	}
+	if payload == nil {
+		payload = &UserEventPayload{}
+	}
+	if err := validateUTCOffsetField(payload.UTCOffset); err != nil {
+		return err
+	}
+	payload.UserID = &realID
+
+	thingIDs := []string{}
+	if config.Associations != nil {
+		var err error
+		thingIDs, err = config.Associations.ThingsForUser(anonymousID)
+		if err != nil {
+			return err
+		}
+	}
+
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
+	events := []Event{}
+	for _, thingID := range thingIDs {
+		disassociatedTimestamp := timestamp + int64(len(events))
+		disassociated, err := client.associationEvent(EventTypeThingDisassociated, thingID, anonymousID, disassociatedTimestamp,
+			uniqueEventID(EventTypeThingDisassociated, disassociatedTimestamp, thingID, anonymousID))
+		if err != nil {
+			return err
+		}
+		associated, err := client.associationEvent(EventTypeThingAssociated, thingID, realID, disassociatedTimestamp+1,
+			uniqueEventID(EventTypeThingAssociated, disassociatedTimestamp+1, thingID, realID))
+		if err != nil {
+			return err
+		}
+		associated.Payload.(map[string]string)["merged_from"] = anonymousID
+		events = append(events, disassociated, associated)
+	}
+
+	updated, err := payloadToMap(payload)
+	if err != nil {
+		return err
+	}
+	updated["merged_from"] = anonymousID
+	updatedTimestamp := timestamp + int64(len(events))
+	events = append(events, Event{
+		EventID:   uniqueEventID(EventTypeUserUpdated, updatedTimestamp, realID),
+		Type:      EventTypeUserUpdated,
+		Timestamp: updatedTimestamp,
+		Payload:   updated,
+	})
+	if deleteAnonymous {
+		deletedTimestamp := timestamp + int64(len(events))
+		events = append(events, Event{
+			EventID:   uniqueEventID(EventTypeUserDeleted, deletedTimestamp, anonymousID),
+			Type:      EventTypeUserDeleted,
+			Timestamp: deletedTimestamp,
+			Payload: map[string]string{
+				"user_id": anonymousID,
+			},
+		})
+	}
+
+	rejected, err := client.sendEvents(events)
+	if err != nil {
+		return err
+	}
+	config.sender.rewrite(func(event Event) (Event, bool) {
+		if !eventMentionsUser(event, anonymousID) {
+			return event, true
+		}
+		payload, err := payloadToMap(event.Payload)
+		if err != nil {
+			return event, true
+		}
+		payload["user_id"] = realID
+		event.Payload = payload
+		return event, true
+	})
+
+	// keep the association store in step with the events that were accepted
+	for index, thingID := range thingIDs {
+		if _, found := rejected[index*2]; !found {
+			if err := client.recordAssociation(thingID, anonymousID, false); err != nil {
+				return err
+			}
+		}
+		if _, found := rejected[index*2+1]; !found {
+			if err := client.recordAssociation(thingID, realID, true); err != nil {
+				return err
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		return &BatchError{
+			Events:   events,
+			Rejected: rejected,
+		}
+	}
+	return nil
+}
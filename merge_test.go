@@ -0,0 +1,118 @@
+package copilot_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeUsers(t *testing.T) {
+	associations := copilot.NewMemoryAssociationStore()
+	recorder := copilottest.NewRecorder(copilot.WithAssociationStore(associations))
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "anon-1", 0, ""))
+	assert.Nil(t, recorder.ThingAssociated("thing-2", "anon-1", 0, ""))
+	recorder.Reset()
+
+	err := recorder.MergeUsers("anon-1", "user-1", 1600000000000, &copilot.UserEventPayload{
+		Email: copilot.String("user@example.com"),
+	}, true)
+	assert.Nil(t, err)
+
+	records := recorder.Records()
+	assert.Len(t, records, 1)
+	types := []string{}
+	for _, event := range records[0].Events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		copilot.EventTypeThingDisassociated, copilot.EventTypeThingAssociated,
+		copilot.EventTypeThingDisassociated, copilot.EventTypeThingAssociated,
+		copilot.EventTypeUserUpdated, copilot.EventTypeUserDeleted,
+	}, types)
+	assert.Equal(t, int64(1600000000005), records[0].Events[5].Timestamp)
+	recorder.AssertEmitted(t, copilot.EventTypeThingAssociated, "user-1", map[string]interface{}{"thing_id": "thing-2", "merged_from": "anon-1"})
+	recorder.AssertEmitted(t, copilot.EventTypeUserUpdated, "user-1", map[string]interface{}{"email": "user@example.com", "merged_from": "anon-1"})
+	recorder.AssertEmitted(t, copilot.EventTypeUserDeleted, "anon-1", nil)
+
+	things, err := associations.ThingsForUser("user-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"thing-1", "thing-2"}, things)
+	things, err = associations.ThingsForUser("anon-1")
+	assert.Nil(t, err)
+	assert.Empty(t, things)
+
+	// things with long IDs that share a prefix keep distinct event IDs
+	recorder.Reset()
+	assert.Nil(t, recorder.ThingAssociated("3f2b8c1e-9a4d-4c1b-8e2f-123456789abc", "anon-3", 0, ""))
+	assert.Nil(t, recorder.ThingAssociated("3f2b8c1e-9a4d-4c1b-8e2f-cba987654321", "anon-3", 0, ""))
+	assert.Nil(t, recorder.MergeUsers("anon-3", "user-3", 0, nil, false))
+	ids := map[string]bool{}
+	for _, event := range recorder.Records()[2].Events {
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, 5)
+
+	// the anonymous user can be kept
+	recorder.Reset()
+	assert.Nil(t, recorder.MergeUsers("anon-2", "user-2", 0, nil, false))
+	assert.Equal(t, 1, len(recorder.Events()))
+	recorder.AssertNotEmitted(t, copilot.EventTypeUserDeleted, "anon-2")
+
+	assert.NotNil(t, recorder.MergeUsers("user-1", "user-1", 0, nil, false))
+	assert.NotNil(t, recorder.MergeUsers("", "user-1", 0, nil, false))
+}
+
+func TestMergeUsersPseudonyms(t *testing.T) {
+	policy := copilot.PrivacyPolicy{
+		PseudonymKey: copilot.RotatingPseudonymKey([]byte("pseudonym-key"), 24*time.Hour),
+	}
+	associations := copilot.NewMemoryAssociationStore()
+	recorder := copilottest.NewRecorder(copilot.WithAssociationStore(associations), copilot.WithPrivacyPolicy(policy))
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "anon-1", 0, ""))
+	recorder.Reset()
+
+	// the anonymous ID is pseudonymized in merged_from, like the user_id it was sent as
+	timestamp := time.UnixMilli(1600000000000)
+	assert.Nil(t, recorder.MergeUsers("anon-1", "user-1", timestamp.UnixMilli(), nil, false))
+	events := recorder.Events()
+	assert.Len(t, events, 3)
+	disassociated := events[0].Payload.(map[string]interface{})
+	assert.Equal(t, policy.Pseudonymize("anon-1", timestamp), disassociated["user_id"])
+	for _, event := range events[1:] {
+		payload := event.Payload.(map[string]interface{})
+		assert.Equal(t, policy.Pseudonymize("user-1", timestamp), payload["user_id"])
+		assert.Equal(t, policy.Pseudonymize("anon-1", timestamp), payload["merged_from"])
+	}
+}
+
+func TestMergeUsersRewritesQueue(t *testing.T) {
+	sink := &holdFirstSink{
+		release: make(chan struct{}),
+		sink:    copilot.NewMemorySink(),
+	}
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithBackgroundSending(10, 1, nil))
+	assert.Nil(t, err)
+
+	// the worker holds the first event, so the next two stay queued
+	assert.Nil(t, client.UserUpdated("user-0", 0, "", nil))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, client.ThingConnected("thing-1", "anon-1", 0, ""))
+	assert.Nil(t, client.ThingConnected("thing-2", "user-2", 0, ""))
+
+	assert.Nil(t, client.MergeUsers("anon-1", "user-1", 0, nil, false))
+
+	close(sink.release)
+	assert.Nil(t, client.Flush(context.Background()))
+	users := map[string]interface{}{}
+	for _, event := range sink.sink.Events() {
+		if event.Type == copilot.EventTypeThingConnected {
+			payload := event.Payload.(map[string]interface{})
+			users[payload["thing_id"].(string)] = payload["user_id"]
+		}
+	}
+	assert.Equal(t, map[string]interface{}{"thing-1": "user-1", "thing-2": "user-2"}, users)
+}
@@ -12,6 +12,11 @@ const (
 // UnsubscribeUserEmail tells Copilot that a user has unsubscribed from email notifications. This should be sent
 // when the user unsubscribes from emails on your system.
 func UnsubscribeUserEmail(email string, timestamp int64, eventID string) error {
+	return DefaultClient().UnsubscribeUserEmail(email, timestamp, eventID)
+}
+
+// UnsubscribeUserEmail is the same as the package level UnsubscribeUserEmail, using the client's configuration
+func (client *Client) UnsubscribeUserEmail(email string, timestamp int64, eventID string) error {
 	// basic error checking and set some defaults
 	if email == "" {
 		return errors.New("email cannot be blank")
@@ -21,6 +26,11 @@ func UnsubscribeUserEmail(email string, timestamp int64, eventID string) error {
 		"email": email,
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = fmt.Sprintf("%s-%s-%d", EventTypeUnsubscribe, email, timestamp)
 	}
@@ -31,5 +41,5 @@ func UnsubscribeUserEmail(email string, timestamp int64, eventID string) error {
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
@@ -36,6 +36,16 @@ type PreexistingThingCreatedPayload struct {
 
 // SyncStarted tells Copilot that a sync of preexisting data has started
 func SyncStarted(timestamp int64, eventID string) error {
+	return DefaultClient().SyncStarted(timestamp, eventID)
+}
+
+// SyncStarted is the same as the package level SyncStarted, using the client's configuration
+func (client *Client) SyncStarted(timestamp int64, eventID string) error {
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = fmt.Sprintf("%s-%d", EventTypePreexistingSyncStarted, timestamp)
 	}
@@ -46,11 +56,21 @@ func SyncStarted(timestamp int64, eventID string) error {
 		Timestamp: timestamp,
 		Payload:   map[string]string{},
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // SyncCompleted tells Copilot that a sync of preexisting data has completed
 func SyncCompleted(timestamp int64, eventID string) error {
+	return DefaultClient().SyncCompleted(timestamp, eventID)
+}
+
+// SyncCompleted is the same as the package level SyncCompleted, using the client's configuration
+func (client *Client) SyncCompleted(timestamp int64, eventID string) error {
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypePreexistingSyncCompleted, "", timestamp)
 	}
@@ -61,12 +81,17 @@ func SyncCompleted(timestamp int64, eventID string) error {
 		Timestamp: timestamp,
 		Payload:   map[string]string{},
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // PreexistingUserCreated tells Copilot that a user has previously been created. Ideally, the payload.OriginalCreationDate
 // field should be set to a Unix timestamp in milliseconds of when the user first was created.
 func PreexistingUserCreated(userID string, timestamp int64, eventID string, payload *PreexistingUserEventPayload) error {
+	return DefaultClient().PreexistingUserCreated(userID, timestamp, eventID, payload)
+}
+
+// PreexistingUserCreated is the same as the package level PreexistingUserCreated, using the client's configuration
+func (client *Client) PreexistingUserCreated(userID string, timestamp int64, eventID string, payload *PreexistingUserEventPayload) error {
 	// basic error checking and set some defaults
 	if userID == "" {
 		return errors.New("userID cannot be blank")
@@ -75,8 +100,16 @@ func PreexistingUserCreated(userID string, timestamp int64, eventID string, payl
 	if payload == nil {
 		payload = &PreexistingUserEventPayload{}
 	}
+	if err := validateUTCOffsetField(payload.UTCOffset); err != nil {
+		return err
+	}
 	payload.UserID = &userID
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypePreexistingUserCreated, userID, timestamp)
 	}
@@ -87,12 +120,17 @@ func PreexistingUserCreated(userID string, timestamp int64, eventID string, payl
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // PreexistingThingCreated tells Copilot that a thing has previously been created. Ideally, the payload.OriginalCreationDate
 // field should be set to a Unix timestamp in milliseconds of when the user first was created.
 func PreexistingThingCreated(thingID string, timestamp int64, eventID string, payload *PreexistingThingCreatedPayload) error {
+	return DefaultClient().PreexistingThingCreated(thingID, timestamp, eventID, payload)
+}
+
+// PreexistingThingCreated is the same as the package level PreexistingThingCreated, using the client's configuration
+func (client *Client) PreexistingThingCreated(thingID string, timestamp int64, eventID string, payload *PreexistingThingCreatedPayload) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
@@ -103,6 +141,11 @@ func PreexistingThingCreated(thingID string, timestamp int64, eventID string, pa
 	}
 	payload.ThingID = &thingID
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypePreexistingThingCreated, thingID, timestamp)
 	}
@@ -113,11 +156,16 @@ func PreexistingThingCreated(thingID string, timestamp int64, eventID string, pa
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // PreexistingThingUserAssociated tells Copilot about a preexisting thing/user association
 func PreexistingThingUserAssociated(thingID string, userID string, timestamp int64, eventID string, originalAssociationDate int64) error {
+	return DefaultClient().PreexistingThingUserAssociated(thingID, userID, timestamp, eventID, originalAssociationDate)
+}
+
+// PreexistingThingUserAssociated is the same as the package level PreexistingThingUserAssociated, using the client's configuration
+func (client *Client) PreexistingThingUserAssociated(thingID string, userID string, timestamp int64, eventID string, originalAssociationDate int64) error {
 	// basic error checking and set some defaults
 	if thingID == "" || userID == "" {
 		return errors.New("thingID and userID cannot be blank")
@@ -131,6 +179,11 @@ func PreexistingThingUserAssociated(thingID string, userID string, timestamp int
 		payload["original_association_date"] = originalAssociationDate
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypePreexistingUserThingAssociated, thingID, timestamp)
 	}
@@ -141,5 +194,8 @@ func PreexistingThingUserAssociated(thingID string, userID string, timestamp int
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	if err := client.sendEvent(&event); err != nil {
+		return err
+	}
+	return client.recordAssociation(thingID, userID, true)
 }
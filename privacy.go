@@ -0,0 +1,206 @@
+package copilot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FieldAction is what a PrivacyPolicy does to a payload field before it is sent
+type FieldAction int
+
+// below are the supported field actions
+const (
+	// FieldDrop removes the field from the payload
+	FieldDrop FieldAction = iota + 1
+	// FieldMask keeps the first character of the value and masks the rest. For emails, the domain is kept.
+	FieldMask
+	// FieldHash replaces the value with a hex HMAC-SHA256 of the value using the policy's HashKey
+	FieldHash
+)
+
+// PseudonymKeyFunc returns the key used to pseudonymize ids for an event at the provided time. Returning
+// different keys over time rotates the pseudonyms.
+type PseudonymKeyFunc func(at time.Time) []byte
+
+// PrivacyPolicy redacts personal information from every event payload, and the consent call, before it leaves
+// the process. It is set with WithPrivacyPolicy and applies the same way regardless of the event type, except that
+// the Fields are not applied to unsubscribe events, since Copilot finds the user by their email.
+type PrivacyPolicy struct {
+	// Fields maps payload keys, such as email, first_name or any custom key, to the action applied to them
+	Fields map[string]FieldAction
+	// HashKey is the HMAC key for FieldHash, which is required when any field is hashed. It is also used to rewrite
+	// event IDs that may contain the original values; if blank, a random key is generated per process.
+	HashKey []byte
+	// PseudonymKey, if set, replaces every user and thing ID, such as the user_id and thing_id, with a consistent
+	// pseudonym derived from the key
+	PseudonymKey PseudonymKeyFunc
+}
+
+// userIDKeys are the payload keys the library sends user IDs in
+var userIDKeys = []string{"user_id", "merged_from"}
+
+// thingIDKeys are the payload keys the library sends thing IDs in
+var thingIDKeys = []string{"thing_id", "replaces", "replaced_by", "parent_thing_id", "cascaded_from"}
+
+// pseudonymKeys are the keys that are pseudonymized by the PseudonymKey
+var pseudonymKeys = append(append([]string{}, userIDKeys...), thingIDKeys...)
+
+// processHashKey is used to rewrite event IDs when the policy does not have a HashKey
+var processHashKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// WithPrivacyPolicy sets the policy used to redact and pseudonymize outgoing payloads. Setup and NewClient
+// return an error if the policy hashes a field without a HashKey.
+func WithPrivacyPolicy(policy PrivacyPolicy) Option {
+	return func(config *configStruct) {
+		if err := policy.validate(); err != nil {
+			config.optionErrors = append(config.optionErrors, err)
+		}
+		config.PrivacyPolicy = &policy
+	}
+}
+
+// validate checks that every hashed field can be hashed with a key, since an unkeyed hash of an email or
+// name can be reversed with a dictionary
+func (policy *PrivacyPolicy) validate() error {
+	if len(policy.HashKey) > 0 {
+		return nil
+	}
+	for key, action := range policy.Fields {
+		if action == FieldHash {
+			return fmt.Errorf("the privacy policy hashes %s, so it needs a HashKey", key)
+		}
+	}
+	return nil
+}
+
+// RotatingPseudonymKey derives a new pseudonym key from the secret for every period, such as every 30 days. Within
+// a period, the same id always has the same pseudonym.
+func RotatingPseudonymKey(secret []byte, period time.Duration) PseudonymKeyFunc {
+	return func(at time.Time) []byte {
+		index := int64(0)
+		if period > 0 {
+			index = at.UnixNano() / int64(period)
+		}
+		message := make([]byte, 8)
+		binary.BigEndian.PutUint64(message, uint64(index))
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(message)
+		return mac.Sum(nil)
+	}
+}
+
+// Pseudonymize returns the pseudonym that is sent in place of the id at the provided time, so that applications
+// can map their own ids to what Copilot sees. If the policy has no PseudonymKey, the id is returned as is.
+func (policy *PrivacyPolicy) Pseudonymize(id string, at time.Time) string {
+	if policy == nil || policy.PseudonymKey == nil || id == "" {
+		return id
+	}
+	return hmacHex(policy.PseudonymKey(at), id)[0:32]
+}
+
+// apply returns a copy of the event with the policy applied to its payload and event ID
+func (policy *PrivacyPolicy) apply(event Event) (Event, error) {
+	if policy == nil {
+		return event, nil
+	}
+	if err := policy.validate(); err != nil {
+		return event, err
+	}
+	payload, err := payloadToMap(event.Payload)
+	if err != nil {
+		return event, err
+	}
+	modified := false
+	at := time.UnixMilli(event.Timestamp)
+	if policy.PseudonymKey != nil {
+		for _, key := range pseudonymKeys {
+			if value, found := payload[key].(string); found && value != "" {
+				payload[key] = policy.Pseudonymize(value, at)
+				modified = true
+			}
+		}
+	}
+	fields := policy.Fields
+	if event.Type == EventTypeUnsubscribe {
+		// the unsubscribe only works with the email as the user gave it
+		fields = nil
+	}
+	for key, action := range fields {
+		value, found := payload[key]
+		if !found || value == nil {
+			continue
+		}
+		switch action {
+		case FieldDrop:
+			delete(payload, key)
+		case FieldMask:
+			payload[key] = maskValue(value)
+		case FieldHash:
+			payload[key] = hmacHex(policy.HashKey, fmt.Sprint(value))
+		default:
+			continue
+		}
+		modified = true
+	}
+	if !modified {
+		return event, nil
+	}
+	event.Payload = payload
+	// the generated event IDs include the user or thing id, and sometimes the email, so they are replaced
+	// with a consistent hash of the original ID
+	key := policy.HashKey
+	if len(key) == 0 {
+		key = processHashKey
+	}
+	event.EventID = fmt.Sprintf("%s-%s", event.Type, hmacHex(key, event.EventID)[0:32])
+	if len(event.EventID) > 50 {
+		event.EventID = event.EventID[0:50]
+	}
+	return event, nil
+}
+
+// payloadToMap converts any payload into a generic map by round tripping it through JSON
+func payloadToMap(payload interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&result)
+	return result, err
+}
+
+// maskValue masks all but the first character of the value, keeping the domain of emails
+func maskValue(value interface{}) string {
+	str, ok := value.(string)
+	if !ok || str == "" {
+		return "***"
+	}
+	domain := ""
+	if index := strings.LastIndex(str, "@"); index > 0 {
+		domain = str[index:]
+		str = str[0:index]
+	}
+	return string([]rune(str)[0:1]) + "***" + domain
+}
+
+// hmacHex returns the hex encoded HMAC-SHA256 of the value
+func hmacHex(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
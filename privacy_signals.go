@@ -0,0 +1,143 @@
+package copilot
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// defaultPrivacySignalCacheSize is the number of users remembered when the cache size is not configured
+const defaultPrivacySignalCacheSize = 10000
+
+// PrivacySignals are the privacy preferences a browser sent with a request
+type PrivacySignals struct {
+	// UserID is blank when the request is not for a known user
+	UserID string
+	// GlobalPrivacyControl is true when the Sec-GPC: 1 header was sent
+	GlobalPrivacyControl bool
+	// DoNotTrack is true when the DNT: 1 header was sent and the middleware honors it
+	DoNotTrack bool
+}
+
+// OptedOut is true when any of the honored signals was sent, meaning the user does not consent
+func (signals PrivacySignals) OptedOut() bool {
+	return signals.GlobalPrivacyControl || signals.DoNotTrack
+}
+
+// privacySignalsKey is the context key for the PrivacySignals of a request
+type privacySignalsKey struct{}
+
+// PrivacySignalsFromContext returns the signals detected by PrivacySignalMiddleware for the request
+func PrivacySignalsFromContext(ctx context.Context) (PrivacySignals, bool) {
+	signals, ok := ctx.Value(privacySignalsKey{}).(PrivacySignals)
+	return signals, ok
+}
+
+// PrivacySignalMiddleware detects Global Privacy Control, and optionally Do Not Track, on each request. When
+// a known user opts out, it calls UpdateUserConsent with false before the next handler runs. Each user is only
+// updated once, until they are evicted from the cache or forgotten. Since the absence of a signal is not consent, requests
+// without one never update consent.
+type PrivacySignalMiddleware struct {
+	// UserID resolves the user for the request, returning blank if there is none
+	UserID func(r *http.Request) string
+	// HonorDoNotTrack treats DNT: 1 the same as Sec-GPC: 1
+	HonorDoNotTrack bool
+	// CacheSize is the number of users remembered; it defaults to 10,000
+	CacheSize int
+	// Client sends the consent updates; if nil, the default client is used
+	Client *Client
+	// Ledger, if set, records each withdrawal with a source of gpc or dnt, and sends it through its own client
+	Ledger *ConsentLedger
+	// OnError is called when a consent update fails. It defaults to logging the error.
+	OnError func(userID string, err error)
+
+	once  sync.Once
+	lock  sync.Mutex
+	order *list.List
+	users map[string]*list.Element
+}
+
+// Wrap returns a handler that detects the signals, updates consent, and adds the signals to the request context
+func (middleware *PrivacySignalMiddleware) Wrap(next http.Handler) http.Handler {
+	middleware.once.Do(func() {
+		if middleware.CacheSize <= 0 {
+			middleware.CacheSize = defaultPrivacySignalCacheSize
+		}
+		if middleware.OnError == nil {
+			middleware.OnError = func(userID string, err error) {
+				log.Printf("copilot consent for %s could not be withdrawn: %v", userID, err)
+			}
+		}
+		middleware.order = list.New()
+		middleware.users = map[string]*list.Element{}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signals := PrivacySignals{
+			GlobalPrivacyControl: strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1",
+			DoNotTrack:           middleware.HonorDoNotTrack && strings.TrimSpace(r.Header.Get("DNT")) == "1",
+		}
+		if middleware.UserID != nil {
+			signals.UserID = middleware.UserID(r)
+		}
+		if signals.UserID != "" && signals.OptedOut() && middleware.claim(signals.UserID) {
+			if err := middleware.withdraw(signals); err != nil {
+				// forget the user so the next request tries again
+				middleware.Forget(signals.UserID)
+				middleware.OnError(signals.UserID, err)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), privacySignalsKey{}, signals)))
+	})
+}
+
+// withdraw withdraws the user's consent, recording it in the ledger if there is one
+func (middleware *PrivacySignalMiddleware) withdraw(signals PrivacySignals) error {
+	if middleware.Ledger == nil {
+		return middleware.Client.UpdateUserConsent(signals.UserID, false)
+	}
+	source := "gpc"
+	if !signals.GlobalPrivacyControl {
+		source = "dnt"
+	}
+	return middleware.Ledger.Record(ConsentEntry{
+		UserID:       signals.UserID,
+		ConsentValue: false,
+		Source:       source,
+		LegalBasis:   LegalBasisConsent,
+		Actor:        "browser",
+	})
+}
+
+// claim records that the user's consent is being withdrawn, returning false if it already has been
+func (middleware *PrivacySignalMiddleware) claim(userID string) bool {
+	middleware.lock.Lock()
+	defer middleware.lock.Unlock()
+	if element, found := middleware.users[userID]; found {
+		middleware.order.MoveToFront(element)
+		return false
+	}
+	middleware.users[userID] = middleware.order.PushFront(userID)
+	for middleware.order.Len() > middleware.CacheSize {
+		oldest := middleware.order.Back()
+		middleware.order.Remove(oldest)
+		delete(middleware.users, oldest.Value.(string))
+	}
+	return true
+}
+
+// Forget removes the user from the cache, so their consent is withdrawn again the next time they opt out. Call
+// it whenever the user's consent is changed elsewhere, such as when they opt back in.
+func (middleware *PrivacySignalMiddleware) Forget(userID string) {
+	middleware.lock.Lock()
+	defer middleware.lock.Unlock()
+	if middleware.users == nil {
+		return
+	}
+	if element, found := middleware.users[userID]; found {
+		middleware.order.Remove(element)
+		delete(middleware.users, userID)
+	}
+}
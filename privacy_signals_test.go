@@ -0,0 +1,78 @@
+package copilot_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivacySignalMiddleware(t *testing.T) {
+	recorder := copilottest.NewRecorder()
+	middleware := &copilot.PrivacySignalMiddleware{
+		UserID: func(r *http.Request) string {
+			return r.Header.Get("X-User")
+		},
+		CacheSize: 2,
+		Client:    recorder.Client,
+		OnError:   func(userID string, err error) {},
+	}
+	var seen copilot.PrivacySignals
+	handler := middleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signals, ok := copilot.PrivacySignalsFromContext(r.Context())
+		assert.True(t, ok)
+		seen = signals
+	}))
+	serve := func(userID string, headers map[string]string) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("X-User", userID)
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	gpc := map[string]string{"Sec-GPC": "1"}
+
+	// no signal, no consent change
+	serve("user-1", nil)
+	assert.False(t, seen.OptedOut())
+	assert.Len(t, recorder.ConsentUpdates(), 0)
+
+	// GPC withdraws consent once
+	serve("user-1", gpc)
+	assert.True(t, seen.GlobalPrivacyControl)
+	assert.Equal(t, "user-1", seen.UserID)
+	serve("user-1", gpc)
+	assert.Len(t, recorder.ConsentUpdates(), 1)
+	recorder.AssertConsent(t, "user-1", false)
+
+	// DNT is ignored unless honored
+	serve("user-2", map[string]string{"DNT": "1"})
+	assert.False(t, seen.OptedOut())
+	middleware.HonorDoNotTrack = true
+	serve("user-2", map[string]string{"DNT": "1"})
+	assert.True(t, seen.DoNotTrack)
+	assert.Len(t, recorder.ConsentUpdates(), 2)
+
+	// anonymous requests carry the signals without a consent update
+	serve("", gpc)
+	assert.True(t, seen.OptedOut())
+	assert.Len(t, recorder.ConsentUpdates(), 2)
+
+	// failures are retried on the next request
+	recorder.FailNext(errors.New("copilot is down"))
+	serve("user-3", gpc)
+	assert.Len(t, recorder.ConsentUpdates(), 2)
+	serve("user-3", gpc)
+	assert.Len(t, recorder.ConsentUpdates(), 3)
+
+	// user-1 was evicted from the cache, and user-3 is forgotten explicitly
+	serve("user-1", gpc)
+	middleware.Forget("user-3")
+	serve("user-3", gpc)
+	assert.Len(t, recorder.ConsentUpdates(), 5)
+}
@@ -0,0 +1,101 @@
+package copilot_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivacyPolicy(t *testing.T) {
+	userID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	email := fmt.Sprintf("%s@wagz.com", userID)
+	now := time.Now()
+
+	policy := &copilot.PrivacyPolicy{
+		Fields: map[string]copilot.FieldAction{
+			"email":      copilot.FieldHash,
+			"first_name": copilot.FieldMask,
+			"last_name":  copilot.FieldDrop,
+		},
+		HashKey:      []byte("hash-key"),
+		PseudonymKey: copilot.RotatingPseudonymKey([]byte("pseudonym-key"), 24*time.Hour),
+	}
+
+	// pseudonyms are consistent within a period and rotate between periods
+	pseudonym := policy.Pseudonymize(userID, now)
+	assert.NotEqual(t, userID, pseudonym)
+	assert.Equal(t, pseudonym, policy.Pseudonymize(userID, now))
+	assert.NotEqual(t, pseudonym, policy.Pseudonymize(userID, now.Add(48*time.Hour)))
+	assert.NotEqual(t, pseudonym, policy.Pseudonymize(userID+"1", now))
+	// without a key, ids are left alone
+	assert.Equal(t, userID, (&copilot.PrivacyPolicy{}).Pseudonymize(userID, now))
+
+	defer copilot.SaveConfig()()
+	sink := copilot.NewMemorySink()
+	err := copilot.Setup("", "", "", "", copilot.WithDryRun(sink), copilot.WithPrivacyPolicy(*policy))
+	assert.Nil(t, err)
+
+	err = copilot.UserCreatedAt(userID, now, "", &copilot.UserEventPayload{
+		Email:     copilot.String(email),
+		FirstName: copilot.String("Test"),
+		LastName:  copilot.String("Test"),
+	})
+	assert.Nil(t, err)
+	err = copilot.UpdateUserConsent(userID, true)
+	assert.Nil(t, err)
+
+	records := sink.Records()
+	if assert.Len(t, records, 2) {
+		event := records[0].Events[0]
+		payload := event.Payload.(map[string]interface{})
+		assert.Equal(t, pseudonym, payload["user_id"])
+		assert.NotEqual(t, email, payload["email"])
+		assert.Equal(t, "T***", payload["first_name"])
+		assert.NotContains(t, payload, "last_name")
+		assert.NotContains(t, event.EventID, userID)
+		// the consent call uses the same pseudonym as the events
+		assert.Equal(t, pseudonym, records[1].Consent.UserID)
+	}
+
+	// consent as of an earlier period uses that period's pseudonym, like the events from then
+	sink.Reset()
+	earlier := now.Add(-48 * time.Hour)
+	err = copilot.UserUpdatedAt(userID, earlier, "", nil)
+	assert.Nil(t, err)
+	err = copilot.UpdateUserConsentAt(userID, false, earlier)
+	assert.Nil(t, err)
+	records = sink.Records()
+	if assert.Len(t, records, 2) {
+		payload := records[0].Events[0].Payload.(map[string]interface{})
+		assert.Equal(t, policy.Pseudonymize(userID, earlier), payload["user_id"])
+		assert.Equal(t, payload["user_id"], records[1].Consent.UserID)
+		assert.NotEqual(t, pseudonym, records[1].Consent.UserID)
+	}
+
+	// the email of an unsubscribe is sent as is, so that Copilot can find the user
+	sink.Reset()
+	err = copilot.UnsubscribeUserEmail(email, 0, "")
+	assert.Nil(t, err)
+	events := sink.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, email, events[0].Payload.(map[string]interface{})["email"])
+	}
+
+	// hashing without a key is rejected, since an unkeyed hash can be reversed with a dictionary
+	unkeyed := copilot.PrivacyPolicy{
+		Fields: map[string]copilot.FieldAction{
+			"email": copilot.FieldHash,
+		},
+	}
+	_, err = copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithPrivacyPolicy(unkeyed))
+	assert.NotNil(t, err)
+	err = copilot.Setup("", "", "", "", copilot.WithDryRun(sink), copilot.WithPrivacyPolicy(unkeyed))
+	assert.NotNil(t, err)
+	unkeyed.Fields["email"] = copilot.FieldMask
+	_, err = copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithPrivacyPolicy(unkeyed))
+	assert.Nil(t, err)
+}
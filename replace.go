@@ -0,0 +1,152 @@
+package copilot
+
+import (
+	"errors"
+)
+
+// ThingReplacementPayload describes a thing that replaced another, such as under warranty
+type ThingReplacementPayload struct {
+	// UserIDs are the users to move to the new thing. If empty, they are taken from the association store.
+	UserIDs []string
+	// FirmwareVersion and Model are the new thing's
+	FirmwareVersion string
+	Model           string
+	// PreviousFirmwareVersion and PreviousModel are the old thing's, recorded on the new one as its history
+	PreviousFirmwareVersion string
+	PreviousModel           string
+	// StatusKey and StatusValue are the old thing's final status; they default to status and replaced
+	StatusKey   string
+	StatusValue string
+	// Reason is recorded on the old thing's final status, such as the RMA number
+	Reason string
+}
+
+// ReplaceThing tells Copilot that a thing was replaced by a new one, such as under warranty. In a single request,
+// it sends ThingCreated for the new thing, moves each user from the old thing to the new one with ThingDisassociated
+// and ThingAssociated, and sends ThingStatusChanged with the old thing's final status. The new thing's events have
+// a replaces field with the old thing's ID, and the old thing's have a replaced_by field with the new one's. Each
+// event is one millisecond after the one before it so the order also holds when sorted by time. If Copilot rejects
+// any of the events, a *BatchError is returned.
+func ReplaceThing(oldThingID string, newThingID string, timestamp int64, payload *ThingReplacementPayload) error {
+	return DefaultClient().ReplaceThing(oldThingID, newThingID, timestamp, payload)
+}
+
+// ReplaceThing is the same as the package level ReplaceThing, using the client's configuration
+func (client *Client) ReplaceThing(oldThingID string, newThingID string, timestamp int64, payload *ThingReplacementPayload) error {
+	// basic error checking and set some defaults
+	if oldThingID == "" || newThingID == "" {
+		return errors.New("oldThingID and newThingID cannot be blank")
+	}
+	if oldThingID == newThingID {
+		return errors.New("oldThingID and newThingID cannot be the same")
+	}
+	if payload == nil {
+		payload = &ThingReplacementPayload{}
+	}
+	if payload.StatusKey == "" {
+		payload.StatusKey = "status"
+	}
+	if payload.StatusValue == "" {
+		payload.StatusValue = "replaced"
+	}
+	userIDs := payload.UserIDs
+	if len(userIDs) == 0 {
+		config := client.configuration()
+		if config != nil && config.Associations != nil {
+			var err error
+			userIDs, err = config.Associations.UsersForThing(oldThingID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
+	created := map[string]interface{}{
+		"thing_id": newThingID,
+		"replaces": oldThingID,
+	}
+	for key, value := range map[string]string{
+		"firmware_version":          payload.FirmwareVersion,
+		"model":                     payload.Model,
+		"previous_firmware_version": payload.PreviousFirmwareVersion,
+		"previous_model":            payload.PreviousModel,
+	} {
+		if value != "" {
+			created[key] = value
+		}
+	}
+	events := []Event{
+		{
+			EventID:   uniqueEventID(EventTypeThingCreated, timestamp, newThingID),
+			Type:      EventTypeThingCreated,
+			Timestamp: timestamp,
+			Payload:   created,
+		},
+	}
+
+	for _, userID := range userIDs {
+		disassociatedTimestamp := timestamp + int64(len(events))
+		disassociated, err := client.associationEvent(EventTypeThingDisassociated, oldThingID, userID, disassociatedTimestamp,
+			uniqueEventID(EventTypeThingDisassociated, disassociatedTimestamp, oldThingID, userID))
+		if err != nil {
+			return err
+		}
+		disassociated.Payload.(map[string]string)["replaced_by"] = newThingID
+		associated, err := client.associationEvent(EventTypeThingAssociated, newThingID, userID, disassociatedTimestamp+1,
+			uniqueEventID(EventTypeThingAssociated, disassociatedTimestamp+1, newThingID, userID))
+		if err != nil {
+			return err
+		}
+		associated.Payload.(map[string]string)["replaces"] = oldThingID
+		events = append(events, disassociated, associated)
+	}
+
+	statusTimestamp := timestamp + int64(len(events))
+	status := map[string]interface{}{
+		"thing_id":     oldThingID,
+		"status_key":   payload.StatusKey,
+		"status_value": payload.StatusValue,
+		"status_date":  statusTimestamp,
+		"replaced_by":  newThingID,
+	}
+	if payload.Reason != "" {
+		status["reason"] = payload.Reason
+	}
+	events = append(events, Event{
+		EventID:   uniqueEventID(EventTypeThingStatusChanged, statusTimestamp, oldThingID),
+		Type:      EventTypeThingStatusChanged,
+		Timestamp: statusTimestamp,
+		Payload:   status,
+	})
+
+	rejected, err := client.sendEvents(events)
+	if err != nil {
+		return err
+	}
+	// keep the association store in step with the events that were accepted
+	for index := 1; index < len(events)-1; index += 2 {
+		userID := userIDs[(index-1)/2]
+		if _, found := rejected[index]; !found {
+			if err := client.recordAssociation(oldThingID, userID, false); err != nil {
+				return err
+			}
+		}
+		if _, found := rejected[index+1]; !found {
+			if err := client.recordAssociation(newThingID, userID, true); err != nil {
+				return err
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		return &BatchError{
+			Events:   events,
+			Rejected: rejected,
+		}
+	}
+	return nil
+}
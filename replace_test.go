@@ -0,0 +1,148 @@
+package copilot_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceThing(t *testing.T) {
+	associations := copilot.NewMemoryAssociationStore()
+	recorder := copilottest.NewRecorder(copilot.WithAssociationStore(associations))
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "user-1", 0, ""))
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "user-2", 0, ""))
+	recorder.Reset()
+
+	err := recorder.ReplaceThing("thing-1", "thing-2", 1600000000000, &copilot.ThingReplacementPayload{
+		FirmwareVersion:         "2.0.0",
+		Model:                   "feeder-2",
+		PreviousFirmwareVersion: "1.4.2",
+		PreviousModel:           "feeder-1",
+		Reason:                  "rma-1234",
+	})
+	assert.Nil(t, err)
+
+	// everything is sent in a single request, in order
+	records := recorder.Records()
+	assert.Len(t, records, 1)
+	events := records[0].Events
+	types := []string{}
+	for i, event := range events {
+		types = append(types, event.Type)
+		assert.Equal(t, int64(1600000000000+i), event.Timestamp)
+	}
+	assert.Equal(t, []string{
+		copilot.EventTypeThingCreated,
+		copilot.EventTypeThingDisassociated, copilot.EventTypeThingAssociated,
+		copilot.EventTypeThingDisassociated, copilot.EventTypeThingAssociated,
+		copilot.EventTypeThingStatusChanged,
+	}, types)
+	created, err := copilottest.Payload[map[string]string](events[0])
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"thing_id":                  "thing-2",
+		"replaces":                  "thing-1",
+		"firmware_version":          "2.0.0",
+		"model":                     "feeder-2",
+		"previous_firmware_version": "1.4.2",
+		"previous_model":            "feeder-1",
+	}, created)
+	recorder.AssertEmitted(t, copilot.EventTypeThingAssociated, "user-2", map[string]interface{}{"thing_id": "thing-2", "replaces": "thing-1"})
+	recorder.AssertEmitted(t, copilot.EventTypeThingDisassociated, "user-2", map[string]interface{}{"thing_id": "thing-1", "replaced_by": "thing-2"})
+	status, err := copilottest.Payload[copilot.ThingStatusChangedPayload](events[5])
+	assert.Nil(t, err)
+	assert.Equal(t, "thing-1", *status.ThingID)
+	assert.Equal(t, "replaced", *status.StatusValue)
+
+	users, err := associations.UsersForThing("thing-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-1", "user-2"}, users)
+	users, err = associations.UsersForThing("thing-1")
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+
+	// rejected events are reported and the accepted ones are still recorded
+	recorder.RejectOn(copilot.EventTypeThingStatusChanged, "thing is unknown")
+	err = recorder.ReplaceThing("thing-2", "thing-3", 0, &copilot.ThingReplacementPayload{UserIDs: []string{"user-1"}})
+	batchErr := &copilot.BatchError{}
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Len(t, batchErr.Events, 4)
+	assert.Len(t, batchErr.Rejected, 1)
+	assert.NotNil(t, batchErr.Rejected[3])
+	users, err = associations.UsersForThing("thing-3")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-1"}, users)
+
+	assert.NotNil(t, recorder.ReplaceThing("thing-1", "thing-1", 0, nil))
+	assert.NotNil(t, recorder.ReplaceThing("", "thing-1", 0, nil))
+}
+
+func TestReplaceThingPseudonyms(t *testing.T) {
+	policy := copilot.PrivacyPolicy{
+		PseudonymKey: copilot.RotatingPseudonymKey([]byte("pseudonym-key"), 24*time.Hour),
+	}
+	recorder := copilottest.NewRecorder(copilot.WithPrivacyPolicy(policy))
+
+	// the old and new thing IDs are pseudonymized wherever they are sent
+	timestamp := time.UnixMilli(1600000000000)
+	err := recorder.ReplaceThing("thing-1", "thing-2", timestamp.UnixMilli(), &copilot.ThingReplacementPayload{UserIDs: []string{"user-1"}})
+	assert.Nil(t, err)
+	events := recorder.Events()
+	assert.Len(t, events, 4)
+	oldPseudonym := policy.Pseudonymize("thing-1", timestamp)
+	newPseudonym := policy.Pseudonymize("thing-2", timestamp)
+	created := events[0].Payload.(map[string]interface{})
+	assert.Equal(t, newPseudonym, created["thing_id"])
+	assert.Equal(t, oldPseudonym, created["replaces"])
+	disassociated := events[1].Payload.(map[string]interface{})
+	assert.Equal(t, oldPseudonym, disassociated["thing_id"])
+	assert.Equal(t, newPseudonym, disassociated["replaced_by"])
+	associated := events[2].Payload.(map[string]interface{})
+	assert.Equal(t, oldPseudonym, associated["replaces"])
+	status := events[3].Payload.(map[string]interface{})
+	assert.Equal(t, newPseudonym, status["replaced_by"])
+	for _, event := range events {
+		for _, value := range event.Payload.(map[string]interface{}) {
+			assert.NotEqual(t, "thing-1", value)
+			assert.NotEqual(t, "thing-2", value)
+		}
+	}
+}
+
+func TestReplaceThingEventIDs(t *testing.T) {
+	associations := copilot.NewMemoryAssociationStore()
+	// only user-b's association is rejected
+	recorder := copilottest.NewRecorder(copilot.WithAssociationStore(associations),
+		copilot.WithDryRunValidator(func(event copilot.Event) string {
+			payload := event.Payload.(map[string]interface{})
+			if event.Type == copilot.EventTypeThingAssociated && payload["user_id"] == "user-b" {
+				return "user is blocked"
+			}
+			return ""
+		}))
+	oldThingID := "3f2b8c1e-9a4d-4c1b-8e2f-123456789abc"
+	newThingID := "3f2b8c1e-9a4d-4c1b-8e2f-cba987654321"
+
+	err := recorder.ReplaceThing(oldThingID, newThingID, 0, &copilot.ThingReplacementPayload{
+		UserIDs: []string{"user-a", "user-b", "user-c"},
+	})
+	batchErr := &copilot.BatchError{}
+	assert.True(t, errors.As(err, &batchErr))
+
+	// every event keeps a distinct ID, so the rejection is matched to the right one
+	ids := map[string]bool{}
+	for _, event := range recorder.Events() {
+		assert.LessOrEqual(t, len(event.EventID), 50)
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, 8)
+	assert.Len(t, batchErr.Rejected, 1)
+	assert.NotNil(t, batchErr.Rejected[4])
+	users, err := associations.UsersForThing(newThingID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-a", "user-c"}, users)
+}
@@ -0,0 +1,415 @@
+package copilot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrClientClosed is returned for any event or consent call made after Close has been called
+var ErrClientClosed = errors.New("copilot client is closed")
+
+// replacedCloseTimeout is how long the events queued by a configuration replaced by Setup have to be sent
+const replacedCloseTimeout = 30 * time.Second
+
+// ErrQueueFull is returned when background sending is enabled and the queue has no room for the event
+var ErrQueueFull = errors.New("copilot event queue is full")
+
+// UnsentEventsError is returned by Close when the context expires before every queued event was sent. The
+// events still queued were removed and not sent. Events that were being sent when the context expired are
+// included as well, since Close does not wait for them, though they may still reach Copilot.
+type UnsentEventsError struct {
+	Events []Event
+	Err    error
+}
+
+func (err *UnsentEventsError) Error() string {
+	return fmt.Sprintf("%d copilot events were not sent: %v", len(err.Events), err.Err)
+}
+
+func (err *UnsentEventsError) Unwrap() error {
+	return err.Err
+}
+
+// WithBackgroundSending queues events and sends them from the number of workers, so event calls return as soon
+// as the event is queued. Calls return ErrQueueFull if the queue is full. Errors from sending, including
+// rejected events, are passed to onError, which defaults to logging them. Consent calls are always sent directly.
+func WithBackgroundSending(queueSize int, workers int, onError func(event Event, err error)) Option {
+	return func(config *configStruct) {
+		if queueSize < 1 {
+			queueSize = 1
+		}
+		if workers < 1 {
+			workers = 1
+		}
+		if onError == nil {
+			onError = func(event Event, err error) {
+				log.Printf("copilot event %s could not be sent: %v", event.EventID, err)
+			}
+		}
+		config.QueueSize = queueSize
+		config.QueueWorkers = workers
+		config.OnSendError = onError
+	}
+}
+
+// sender tracks every call in flight for a configuration so that it can be flushed and closed, and runs the
+// workers when background sending is enabled
+type sender struct {
+	lock    sync.Mutex
+	closed  bool
+	pending int
+	// idle is closed and replaced whenever pending drops to zero
+	idle chan struct{}
+
+	queue chan queuedEvent
+	// unsent holds every event that was queued and has not been sent yet, including those being sent, by sequence
+	unsent   map[uint64]Event
+	sequence uint64
+	// sent is closed and replaced whenever a queued event is done being sent
+	sent    chan struct{}
+	done    chan struct{}
+	workers sync.WaitGroup
+}
+
+// queuedEvent is an event in the background queue, with the sequence it is tracked by until it is sent
+type queuedEvent struct {
+	sequence uint64
+	event    Event
+}
+
+// newSender creates the sender for the configuration, starting any background workers
+func newSender(config *configStruct) *sender {
+	sender := &sender{
+		idle: make(chan struct{}),
+	}
+	if config.QueueWorkers > 0 {
+		sender.queue = make(chan queuedEvent, config.QueueSize)
+		sender.unsent = map[uint64]Event{}
+		sender.sent = make(chan struct{})
+		sender.done = make(chan struct{})
+		client := &Client{config: config}
+		for i := 0; i < config.QueueWorkers; i++ {
+			sender.workers.Add(1)
+			go sender.work(client, config.OnSendError)
+		}
+	}
+	return sender
+}
+
+// begin records a call in flight, failing if the sender is closed; the lock must be held
+func (sender *sender) begin() error {
+	if sender.closed {
+		return ErrClientClosed
+	}
+	sender.pending++
+	return nil
+}
+
+// end records that a call in flight has completed
+func (sender *sender) end() {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+	sender.pending--
+	if sender.pending == 0 {
+		close(sender.idle)
+		sender.idle = make(chan struct{})
+	}
+}
+
+// send delivers the event directly, or queues it when background sending is enabled
+func (sender *sender) send(client *Client, event Event) error {
+	sender.lock.Lock()
+	if err := sender.begin(); err != nil {
+		sender.lock.Unlock()
+		return err
+	}
+	if sender.queue == nil {
+		sender.lock.Unlock()
+		defer sender.end()
+		return client.collectEvent(&event)
+	}
+	// queue while holding the lock so that nothing is queued once the sender is closed
+	sender.sequence++
+	select {
+	case sender.queue <- queuedEvent{sequence: sender.sequence, event: event}:
+		sender.unsent[sender.sequence] = event
+		sender.lock.Unlock()
+		return nil
+	default:
+		sender.lock.Unlock()
+		sender.end()
+		return ErrQueueFull
+	}
+}
+
+// do runs a call that cannot be queued, such as a consent update, so that it is still flushed
+func (sender *sender) do(call func() error) error {
+	sender.lock.Lock()
+	err := sender.begin()
+	sender.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	defer sender.end()
+	return call()
+}
+
+// purge removes every queued event that matches, returning how many were removed
+func (sender *sender) purge(match func(event Event) bool) int {
+	return sender.rewrite(func(event Event) (Event, bool) {
+		return event, !match(event)
+	})
+}
+
+// rewrite replaces every queued event with the result of the function, removing those it does not keep, and
+// returns how many were removed
+func (sender *sender) rewrite(rewrite func(event Event) (Event, bool)) int {
+	if sender.queue == nil {
+		return 0
+	}
+	removed := 0
+	sender.lock.Lock()
+	// nothing can be queued while the lock is held, so the kept events always fit back in the queue
+	kept := []queuedEvent{}
+	for len(sender.queue) > 0 {
+		select {
+		case queued := <-sender.queue:
+			if event, keep := rewrite(queued.event); keep {
+				queued.event = event
+				sender.unsent[queued.sequence] = event
+				kept = append(kept, queued)
+			} else {
+				delete(sender.unsent, queued.sequence)
+				removed++
+			}
+		default:
+		}
+	}
+	for _, queued := range kept {
+		sender.queue <- queued
+	}
+	sender.lock.Unlock()
+	for i := 0; i < removed; i++ {
+		sender.end()
+	}
+	return removed
+}
+
+// wait waits until none of the queued events that match are left to be sent, or the context expires. Call purge
+// first to wait only for those already being sent.
+func (sender *sender) wait(ctx context.Context, match func(event Event) bool) error {
+	if sender.queue == nil {
+		return nil
+	}
+	for {
+		sender.lock.Lock()
+		found := false
+		for _, event := range sender.unsent {
+			if match(event) {
+				found = true
+				break
+			}
+		}
+		sent := sender.sent
+		sender.lock.Unlock()
+		if !found {
+			return nil
+		}
+		select {
+		case <-sent:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// work sends queued events until the sender is stopped
+func (sender *sender) work(client *Client, onError func(event Event, err error)) {
+	defer sender.workers.Done()
+	for {
+		// check done first so that stopping is not delayed by a busy queue
+		select {
+		case <-sender.done:
+			return
+		default:
+		}
+		select {
+		case <-sender.done:
+			return
+		case queued := <-sender.queue:
+			select {
+			case <-sender.done:
+				// the sender was closed as the event was taken, so it is left for close to report as unsent
+				sender.end()
+				return
+			default:
+			}
+			event := queued.event
+			if err := client.collectEvent(&event); err != nil {
+				onError(event, err)
+			}
+			sender.lock.Lock()
+			delete(sender.unsent, queued.sequence)
+			close(sender.sent)
+			sender.sent = make(chan struct{})
+			sender.lock.Unlock()
+			sender.end()
+		}
+	}
+}
+
+// flush waits until no calls are in flight or the context expires
+func (sender *sender) flush(ctx context.Context) error {
+	for {
+		sender.lock.Lock()
+		pending := sender.pending
+		idle := sender.idle
+		sender.lock.Unlock()
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// close rejects new calls, flushes, and stops the workers. If the context expires first, the workers are not
+// waited for, and the events still queued or being sent are returned.
+func (sender *sender) close(ctx context.Context) error {
+	sender.lock.Lock()
+	if sender.closed {
+		sender.lock.Unlock()
+		return nil
+	}
+	sender.closed = true
+	sender.lock.Unlock()
+
+	flushErr := sender.flush(ctx)
+	if sender.queue == nil {
+		return flushErr
+	}
+	close(sender.done)
+	if flushErr == nil {
+		// nothing is in flight, so the workers stop right away
+		sender.workers.Wait()
+		return nil
+	}
+
+	// a worker may be stuck sending, so instead of waiting for them, empty the queue so that they stop once
+	// they are done and report everything that was not sent
+	sender.lock.Lock()
+	drained := 0
+	for len(sender.queue) > 0 {
+		select {
+		case <-sender.queue:
+			drained++
+		default:
+		}
+	}
+	sequences := make([]uint64, 0, len(sender.unsent))
+	for sequence := range sender.unsent {
+		sequences = append(sequences, sequence)
+	}
+	sort.Slice(sequences, func(i, j int) bool {
+		return sequences[i] < sequences[j]
+	})
+	unsent := make([]Event, 0, len(sequences))
+	for _, sequence := range sequences {
+		unsent = append(unsent, sender.unsent[sequence])
+	}
+	sender.unsent = map[uint64]Event{}
+	sender.lock.Unlock()
+	for i := 0; i < drained; i++ {
+		sender.end()
+	}
+
+	if len(unsent) > 0 {
+		return &UnsentEventsError{
+			Events: unsent,
+			Err:    flushErr,
+		}
+	}
+	return flushErr
+}
+
+// closeReplaced closes the sender of a configuration that was replaced by Setup in the background, so that its
+// workers stop once the events already queued are sent
+func (sender *sender) closeReplaced() {
+	if sender.queue == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), replacedCloseTimeout)
+		defer cancel()
+		if err := sender.close(ctx); err != nil {
+			log.Printf("copilot events queued before Setup was called again could not be sent: %v", err)
+		}
+	}()
+}
+
+// Flush blocks until every event and consent call in flight, including queued events, has been acknowledged by
+// Copilot or the context expires
+func Flush(ctx context.Context) error {
+	return DefaultClient().Flush(ctx)
+}
+
+// Flush is the same as the package level Flush, using the client's configuration
+func (client *Client) Flush(ctx context.Context) error {
+	config := client.configuration()
+	if config == nil {
+		return nil
+	}
+	return config.sender.flush(ctx)
+}
+
+// Close flushes and then stops the background workers. Every call made after Close returns ErrClientClosed.
+// If the context expires first, the events still queued are returned in an UnsentEventsError.
+func Close(ctx context.Context) error {
+	return DefaultClient().Close(ctx)
+}
+
+// Close is the same as the package level Close, using the client's configuration
+func (client *Client) Close(ctx context.Context) error {
+	config := client.configuration()
+	if config == nil {
+		return nil
+	}
+	return config.sender.close(ctx)
+}
+
+// CloseOnSignal closes the default client when the process receives one of the signals, which default to
+// SIGINT and SIGTERM. See Client.CloseOnSignal.
+func CloseOnSignal(timeout time.Duration, signals ...os.Signal) <-chan error {
+	return DefaultClient().CloseOnSignal(timeout, signals...)
+}
+
+// CloseOnSignal closes the client, waiting up to the timeout, when the process receives one of the signals,
+// which default to SIGINT and SIGTERM. The result of Close is sent on the returned channel, so the caller can
+// report any unsent events before exiting.
+func (client *Client) CloseOnSignal(timeout time.Duration, signals ...os.Signal) <-chan error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	result := make(chan error, 1)
+	go func() {
+		<-received
+		signal.Stop(received)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		result <- client.Close(ctx)
+	}()
+	return result
+}
@@ -0,0 +1,116 @@
+package copilot_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedSink blocks every write until the gate is opened
+type gatedSink struct {
+	gate chan struct{}
+	sink *copilot.MemorySink
+}
+
+func (sink *gatedSink) Write(record copilot.DryRunRecord) error {
+	<-sink.gate
+	return sink.sink.Write(record)
+}
+
+func TestFlushAndClose(t *testing.T) {
+	sink := &gatedSink{
+		gate: make(chan struct{}),
+		sink: copilot.NewMemorySink(),
+	}
+	sendErrors := make(chan error, 10)
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithBackgroundSending(2, 1, func(event copilot.Event, err error) {
+		sendErrors <- err
+	}))
+	assert.Nil(t, err)
+
+	// the worker takes the first event and blocks, leaving room for two more
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, client.UserDeleted("user-2", 0, ""))
+	assert.Nil(t, client.UserDeleted("user-3", 0, ""))
+	assert.Equal(t, copilot.ErrQueueFull, client.UserDeleted("user-4", 0, ""))
+
+	// flushing times out while the sink is blocked
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.Flush(ctx))
+
+	close(sink.gate)
+	assert.Nil(t, client.Flush(context.Background()))
+	assert.Len(t, sink.sink.Events(), 3)
+	assert.Len(t, sendErrors, 0)
+
+	assert.Nil(t, client.Close(context.Background()))
+	assert.Equal(t, copilot.ErrClientClosed, client.UserDeleted("user-5", 0, ""))
+	assert.Equal(t, copilot.ErrClientClosed, client.UpdateUserConsent("user-5", true))
+	// closing again is a no-op
+	assert.Nil(t, client.Close(context.Background()))
+}
+
+func TestCloseReportsUnsent(t *testing.T) {
+	sink := &gatedSink{
+		gate: make(chan struct{}),
+		sink: copilot.NewMemorySink(),
+	}
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(sink), copilot.WithBackgroundSending(5, 1, nil))
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, client.UserDeleted("user-2", 0, ""))
+	assert.Nil(t, client.UserDeleted("user-3", 0, ""))
+
+	// the close does not wait for the event in flight once the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err = client.Close(ctx)
+	assert.Less(t, time.Since(started), time.Second)
+	unsent := &copilot.UnsentEventsError{}
+	if assert.True(t, errors.As(err, &unsent)) && assert.Len(t, unsent.Events, 3) {
+		for i, userID := range []string{"user-1", "user-2", "user-3"} {
+			payload := unsent.Events[i].Payload.(*copilot.UserEventPayload)
+			assert.Equal(t, userID, *payload.UserID)
+		}
+	}
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Empty(t, sink.sink.Events())
+
+	// the event in flight finishes, but the queued events are never sent
+	close(sink.gate)
+	assert.Nil(t, client.Flush(context.Background()))
+	assert.Len(t, sink.sink.Events(), 1)
+}
+
+func TestSetupClosesPreviousSender(t *testing.T) {
+	defer copilot.SaveConfig()()
+	sink := copilot.NewMemorySink()
+	assert.Nil(t, copilot.Setup("", "", "", "", copilot.WithDryRun(sink), copilot.WithBackgroundSending(5, 1, nil)))
+	previous := copilot.ConfiguredClient()
+	assert.Nil(t, copilot.UserDeleted("user-1", 0, ""))
+
+	// the queued event is still sent with the previous configuration before its workers stop
+	assert.Nil(t, copilot.Setup("", "", "", "", copilot.WithDryRun(copilot.NewMemorySink())))
+	assert.Eventually(t, func() bool {
+		return previous.UserDeleted("user-2", 0, "") == copilot.ErrClientClosed
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, previous.Flush(context.Background()))
+	assert.Len(t, sink.Events(), 1)
+}
+
+func TestCloseWithoutBackgroundSending(t *testing.T) {
+	client, err := copilot.NewClient("", "", "", "", copilot.WithDryRun(copilot.NewMemorySink()))
+	assert.Nil(t, err)
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	assert.Nil(t, client.Close(context.Background()))
+	assert.Equal(t, copilot.ErrClientClosed, client.UserDeleted("user-1", 0, ""))
+}
@@ -0,0 +1,204 @@
+package copilot
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusRecord is the last status value that was sent to Copilot for a thing's status key
+type StatusRecord struct {
+	Value string `json:"value"`
+	// SentAt is the Unix timestamp in milliseconds of when the value was last sent
+	SentAt int64 `json:"sent_at"`
+}
+
+// StatusStore holds the last known status values for a StatusTracker. Implement it to persist
+// the values across restarts or to share them between processes.
+type StatusStore interface {
+	// GetStatus returns the record for the key, or nil if nothing has been stored yet
+	GetStatus(thingID, statusKey string) (*StatusRecord, error)
+	SetStatus(thingID, statusKey string, record StatusRecord) error
+	// ThingStatuses returns every stored status key for the thing
+	ThingStatuses(thingID string) (map[string]StatusRecord, error)
+}
+
+// MemoryStatusStore is an in-memory StatusStore and the default used by the StatusTracker
+type MemoryStatusStore struct {
+	lock     sync.RWMutex
+	statuses map[string]map[string]StatusRecord
+}
+
+// NewMemoryStatusStore creates an empty in-memory status store
+func NewMemoryStatusStore() *MemoryStatusStore {
+	return &MemoryStatusStore{
+		statuses: map[string]map[string]StatusRecord{},
+	}
+}
+
+// GetStatus returns the record for the key, or nil if nothing has been stored yet
+func (store *MemoryStatusStore) GetStatus(thingID, statusKey string) (*StatusRecord, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	record, found := store.statuses[thingID][statusKey]
+	if !found {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// SetStatus stores the record for the key
+func (store *MemoryStatusStore) SetStatus(thingID, statusKey string, record StatusRecord) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if _, found := store.statuses[thingID]; !found {
+		store.statuses[thingID] = map[string]StatusRecord{}
+	}
+	store.statuses[thingID][statusKey] = record
+	return nil
+}
+
+// ThingStatuses returns a copy of every stored status key for the thing
+func (store *MemoryStatusStore) ThingStatuses(thingID string) (map[string]StatusRecord, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	statuses := map[string]StatusRecord{}
+	for key, record := range store.statuses[thingID] {
+		statuses[key] = record
+	}
+	return statuses, nil
+}
+
+// statusTrackerLockCount is the number of lock stripes used to serialize observations of the same key
+const statusTrackerLockCount = 64
+
+// StatusTracker wraps ThingStatusChanged so that a status is only sent to Copilot when its value actually
+// changes, or when the last sent value is older than the max staleness. This allows the status of a thing
+// to be polled and observed frequently without flooding Copilot with unchanged values.
+type StatusTracker struct {
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+
+	store        StatusStore
+	maxStaleness time.Duration
+
+	deadbandLock sync.RWMutex
+	deadbands    map[string]float64
+
+	locks [statusTrackerLockCount]sync.Mutex
+}
+
+// NewStatusTracker creates a new tracker. If the store is nil, an in-memory store is used. If maxStaleness is 0,
+// unchanged values are never resent.
+func NewStatusTracker(store StatusStore, maxStaleness time.Duration) *StatusTracker {
+	if store == nil {
+		store = NewMemoryStatusStore()
+	}
+	return &StatusTracker{
+		store:        store,
+		maxStaleness: maxStaleness,
+		deadbands:    map[string]float64{},
+	}
+}
+
+// SetDeadband sets a numeric deadband for a status key, such as a battery level. When both the last sent value and
+// the observed value are numbers, the observed value is only sent if it differs from the last sent value by at
+// least the deadband.
+func (tracker *StatusTracker) SetDeadband(statusKey string, deadband float64) {
+	tracker.deadbandLock.Lock()
+	defer tracker.deadbandLock.Unlock()
+	tracker.deadbands[statusKey] = deadband
+}
+
+// Observe records the current status value of a thing, calling ThingStatusChanged if the value has changed or the
+// last sent value is stale. It returns true if an event was sent. The stored value is only updated once Copilot
+// accepts the event, so a failed send is retried on the next observation. The userID is optional.
+func (tracker *StatusTracker) Observe(thingID, userID, statusKey, statusValue string, timestamp int64) (bool, error) {
+	if thingID == "" {
+		return false, errors.New("thingID cannot be blank")
+	}
+	if statusKey == "" || statusValue == "" {
+		return false, errors.New("statusKey and statusValue are required and cannot be blank")
+	}
+	timestamp, err := tracker.Client.resolveTimestamp(timestamp)
+	if err != nil {
+		return false, err
+	}
+
+	lock := tracker.lockFor(thingID, statusKey)
+	lock.Lock()
+	defer lock.Unlock()
+
+	last, err := tracker.store.GetStatus(thingID, statusKey)
+	if err != nil {
+		return false, err
+	}
+	if last != nil && !tracker.changed(statusKey, last.Value, statusValue) && !tracker.stale(last, timestamp) {
+		return false, nil
+	}
+
+	payload := &ThingStatusChangedPayload{
+		StatusKey:   &statusKey,
+		StatusValue: &statusValue,
+	}
+	if userID != "" {
+		payload.UserID = &userID
+	}
+	err = tracker.Client.ThingStatusChanged(thingID, timestamp, "", payload)
+	if err != nil {
+		return false, err
+	}
+	err = tracker.store.SetStatus(thingID, statusKey, StatusRecord{
+		Value:  statusValue,
+		SentAt: timestamp,
+	})
+	return true, err
+}
+
+// Snapshot returns the last values sent to Copilot for the thing, keyed by status key. An observed value that was
+// not sent, such as one within the deadband, is not included.
+func (tracker *StatusTracker) Snapshot(thingID string) (map[string]StatusRecord, error) {
+	return tracker.store.ThingStatuses(thingID)
+}
+
+// changed determines if the observed value differs from the last sent value, taking any deadband into account
+func (tracker *StatusTracker) changed(statusKey, lastValue, statusValue string) bool {
+	if lastValue == statusValue {
+		return false
+	}
+	tracker.deadbandLock.RLock()
+	deadband, found := tracker.deadbands[statusKey]
+	tracker.deadbandLock.RUnlock()
+	if !found {
+		return true
+	}
+	last, err := strconv.ParseFloat(lastValue, 64)
+	if err != nil {
+		return true
+	}
+	observed, err := strconv.ParseFloat(statusValue, 64)
+	if err != nil {
+		return true
+	}
+	return math.Abs(observed-last) >= deadband
+}
+
+// stale determines if the last sent value should be resent regardless of whether it changed
+func (tracker *StatusTracker) stale(last *StatusRecord, timestamp int64) bool {
+	if tracker.maxStaleness <= 0 {
+		return false
+	}
+	return timestamp-last.SentAt >= tracker.maxStaleness.Milliseconds()
+}
+
+// lockFor returns the lock stripe for the thing and status key
+func (tracker *StatusTracker) lockFor(thingID, statusKey string) *sync.Mutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(thingID))
+	hash.Write([]byte{0})
+	hash.Write([]byte(statusKey))
+	return &tracker.locks[hash.Sum32()%statusTrackerLockCount]
+}
@@ -0,0 +1,84 @@
+package copilot_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusTracker(t *testing.T) {
+	timestamp := int64(1600000000000)
+	recorder := copilottest.NewRecorder()
+	store := copilot.NewMemoryStatusStore()
+	store.SetStatus("thing-1", "power", copilot.StatusRecord{Value: "on", SentAt: timestamp})
+	store.SetStatus("thing-1", "battery", copilot.StatusRecord{Value: "80", SentAt: timestamp})
+	tracker := copilot.NewStatusTracker(store, time.Hour)
+	tracker.Client = recorder.Client
+	tracker.SetDeadband("battery", 5)
+
+	// make sure the required fields are checked
+	_, err := tracker.Observe("", "", "power", "on", timestamp)
+	assert.NotNil(t, err)
+	_, err = tracker.Observe("thing-1", "", "", "on", timestamp)
+	assert.NotNil(t, err)
+
+	// unchanged values and values within the deadband are not sent
+	sent, err := tracker.Observe("thing-1", "", "power", "on", timestamp+1000)
+	assert.Nil(t, err)
+	assert.False(t, sent)
+	sent, err = tracker.Observe("thing-1", "", "battery", "77.5", timestamp+1000)
+	assert.Nil(t, err)
+	assert.False(t, sent)
+	assert.Empty(t, recorder.Records())
+
+	// the snapshot has the last sent values, not the ones within the deadband
+	snapshot, err := tracker.Snapshot("thing-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "on", snapshot["power"].Value)
+	assert.Equal(t, "80", snapshot["battery"].Value)
+
+	// changed values and values outside the deadband are sent
+	sent, err = tracker.Observe("thing-1", "user-1", "power", "off", timestamp+2000)
+	assert.Nil(t, err)
+	assert.True(t, sent)
+	recorder.AssertEmitted(t, copilot.EventTypeThingStatusChanged, "user-1", map[string]interface{}{"thing_id": "thing-1", "status_key": "power", "status_value": "off"})
+	sent, err = tracker.Observe("thing-1", "", "battery", "74", timestamp+2000)
+	assert.Nil(t, err)
+	assert.True(t, sent)
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeThingStatusChanged), 2)
+	status, err := copilottest.Payload[copilot.ThingStatusChangedPayload](recorder.Events()[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "battery", *status.StatusKey)
+	assert.Equal(t, "74", *status.StatusValue)
+
+	// stale values are resent even when unchanged
+	recorder.Reset()
+	sent, err = tracker.Observe("thing-1", "", "power", "off", timestamp+2000+time.Hour.Milliseconds()-1)
+	assert.Nil(t, err)
+	assert.False(t, sent)
+	sent, err = tracker.Observe("thing-1", "", "power", "off", timestamp+2000+time.Hour.Milliseconds())
+	assert.Nil(t, err)
+	assert.True(t, sent)
+	events := recorder.EventsOfType(copilot.EventTypeThingStatusChanged)
+	assert.Len(t, events, 1)
+	assert.Equal(t, timestamp+2000+time.Hour.Milliseconds(), events[0].Timestamp)
+
+	// a failed send is not stored, so the next observation tries again
+	recorder.Reset()
+	recorder.FailNext(errors.New("copilot is down"))
+	sent, err = tracker.Observe("thing-1", "", "battery", "60", timestamp+3000)
+	assert.NotNil(t, err)
+	assert.False(t, sent)
+	sent, err = tracker.Observe("thing-1", "", "battery", "60", timestamp+4000)
+	assert.Nil(t, err)
+	assert.True(t, sent)
+
+	snapshot, err = tracker.Snapshot("thing-1")
+	assert.Nil(t, err)
+	assert.Equal(t, copilot.StatusRecord{Value: "off", SentAt: timestamp + 2000 + time.Hour.Milliseconds()}, snapshot["power"])
+	assert.Equal(t, copilot.StatusRecord{Value: "60", SentAt: timestamp + 4000}, snapshot["battery"])
+}
@@ -24,6 +24,8 @@ type ThingCreatedUpdatedPayload struct {
 	UserID          *string `json:"user_id,omitempty"`
 	FirmwareVersion *string `json:"firmware_version,omitempty"`
 	Model           *string `json:"model,omitempty"`
+	// ParentThingID is the thing this one is connected through, such as a hub; a blank value removes the parent
+	ParentThingID *string `json:"parent_thing_id,omitempty"`
 }
 
 // ThingStatusChangedPayload tells Copilot that the status of the thing has changed. This can include
@@ -34,6 +36,8 @@ type ThingStatusChangedPayload struct {
 	StatusValue *string `json:"status_value,omitempty"`
 	StatusDate  *int64  `json:"status_date,omitempty"`
 	UserID      *string `json:"user_id,omitempty"`
+	// CascadedFrom is set when the status was cascaded from a parent thing, such as by the ConnectivityMonitor
+	CascadedFrom *string `json:"cascaded_from,omitempty"`
 }
 
 // ThingInteractionEventPayload holds arbitrary key/values sent as part of the Thing Interaction endpoint call.
@@ -42,6 +46,11 @@ type ThingInteractionEventPayload map[string]interface{}
 // ThingCreated tells Copilot a thing has been created. The thingID is required.
 // All other fields can be blank and a sane default will be used.
 func ThingCreated(thingID string, timestamp int64, eventID string, payload *ThingCreatedUpdatedPayload) error {
+	return DefaultClient().ThingCreated(thingID, timestamp, eventID, payload)
+}
+
+// ThingCreated is the same as the package level ThingCreated, using the client's configuration
+func (client *Client) ThingCreated(thingID string, timestamp int64, eventID string, payload *ThingCreatedUpdatedPayload) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
@@ -51,6 +60,14 @@ func ThingCreated(thingID string, timestamp int64, eventID string, payload *Thin
 		payload = &ThingCreatedUpdatedPayload{}
 	}
 	payload.ThingID = &thingID
+	if err := client.resolveParent(thingID, payload); err != nil {
+		return err
+	}
+
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
 
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeThingCreated, thingID, timestamp)
@@ -62,12 +79,20 @@ func ThingCreated(thingID string, timestamp int64, eventID string, payload *Thin
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	if err := client.sendEvent(&event); err != nil {
+		return err
+	}
+	return client.recordParent(thingID, payload)
 }
 
 // ThingUpdated tells Copilot a thing has been updated. The thingID is required.
 // All other fields can be blank and a sane default will be used.
 func ThingUpdated(thingID string, timestamp int64, eventID string, payload *ThingCreatedUpdatedPayload) error {
+	return DefaultClient().ThingUpdated(thingID, timestamp, eventID, payload)
+}
+
+// ThingUpdated is the same as the package level ThingUpdated, using the client's configuration
+func (client *Client) ThingUpdated(thingID string, timestamp int64, eventID string, payload *ThingCreatedUpdatedPayload) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
@@ -77,6 +102,14 @@ func ThingUpdated(thingID string, timestamp int64, eventID string, payload *Thin
 		payload = &ThingCreatedUpdatedPayload{}
 	}
 	payload.ThingID = &thingID
+	if err := client.resolveParent(thingID, payload); err != nil {
+		return err
+	}
+
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
 
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeThingUpdated, thingID, timestamp)
@@ -88,39 +121,51 @@ func ThingUpdated(thingID string, timestamp int64, eventID string, payload *Thin
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	if err := client.sendEvent(&event); err != nil {
+		return err
+	}
+	return client.recordParent(thingID, payload)
 }
 
 // ThingAssociated tells Copilot that a thing has been associated to a user
 func ThingAssociated(thingID string, userID string, timestamp int64, eventID string) error {
-	// basic error checking and set some defaults
-	if thingID == "" || userID == "" {
-		return errors.New("thingID and userID cannot be blank")
-	}
+	return DefaultClient().ThingAssociated(thingID, userID, timestamp, eventID)
+}
 
-	payload := map[string]string{
-		"user_id":  userID,
-		"thing_id": thingID,
+// ThingAssociated is the same as the package level ThingAssociated, using the client's configuration
+func (client *Client) ThingAssociated(thingID string, userID string, timestamp int64, eventID string) error {
+	event, err := client.associationEvent(EventTypeThingAssociated, thingID, userID, timestamp, eventID)
+	if err != nil {
+		return err
 	}
-
-	if eventID == "" {
-		eventID = eventIDHelper(EventTypeThingAssociated, thingID, timestamp)
+	if err := client.sendEvent(&event); err != nil {
+		return err
 	}
-
-	event := Event{
-		EventID:   eventID,
-		Type:      EventTypeThingAssociated,
-		Timestamp: timestamp,
-		Payload:   payload,
-	}
-	return event.sendEvent()
+	return client.recordAssociation(thingID, userID, true)
 }
 
 // ThingDisassociated tells Copilot that a thing has been disassociated from a user
 func ThingDisassociated(thingID string, userID string, timestamp int64, eventID string) error {
+	return DefaultClient().ThingDisassociated(thingID, userID, timestamp, eventID)
+}
+
+// ThingDisassociated is the same as the package level ThingDisassociated, using the client's configuration
+func (client *Client) ThingDisassociated(thingID string, userID string, timestamp int64, eventID string) error {
+	event, err := client.associationEvent(EventTypeThingDisassociated, thingID, userID, timestamp, eventID)
+	if err != nil {
+		return err
+	}
+	if err := client.sendEvent(&event); err != nil {
+		return err
+	}
+	return client.recordAssociation(thingID, userID, false)
+}
+
+// associationEvent builds either of the association events
+func (client *Client) associationEvent(eventType string, thingID string, userID string, timestamp int64, eventID string) (Event, error) {
 	// basic error checking and set some defaults
 	if thingID == "" || userID == "" {
-		return errors.New("thingID and userID cannot be blank")
+		return Event{}, errors.New("thingID and userID cannot be blank")
 	}
 
 	payload := map[string]string{
@@ -128,23 +173,32 @@ func ThingDisassociated(thingID string, userID string, timestamp int64, eventID
 		"thing_id": thingID,
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return Event{}, err
+	}
+
 	if eventID == "" {
-		eventID = eventIDHelper(EventTypeThingDisassociated, thingID, timestamp)
+		eventID = eventIDHelper(eventType, thingID, timestamp)
 	}
 
-	event := Event{
+	return Event{
 		EventID:   eventID,
-		Type:      EventTypeThingDisassociated,
+		Type:      eventType,
 		Timestamp: timestamp,
 		Payload:   payload,
-	}
-	return event.sendEvent()
+	}, nil
 }
 
 // ThingStatusChanged tells Copilot that the status of the thing has changed (see the comments on the ThingStatusChangedPayload).
 // Note that if the StatusDate field is nil or 0, we will set it to the timestamp's value. The only payload field that is not
 // required is the userID.
 func ThingStatusChanged(thingID string, timestamp int64, eventID string, payload *ThingStatusChangedPayload) error {
+	return DefaultClient().ThingStatusChanged(thingID, timestamp, eventID, payload)
+}
+
+// ThingStatusChanged is the same as the package level ThingStatusChanged, using the client's configuration
+func (client *Client) ThingStatusChanged(thingID string, timestamp int64, eventID string, payload *ThingStatusChangedPayload) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
@@ -161,6 +215,11 @@ func ThingStatusChanged(thingID string, timestamp int64, eventID string, payload
 		return errors.New("StatusKey and StatusValue are required and cannot be blank")
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if payload.StatusDate == nil || *payload.StatusDate == 0 {
 		payload.StatusDate = &timestamp
 	}
@@ -177,12 +236,17 @@ func ThingStatusChanged(thingID string, timestamp int64, eventID string, payload
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // ThingIneraction tells Copilot about an arbitrary interaction. You can set any fields you want in the payload and they
 // will be passed straight through.
 func ThingIneraction(thingID string, timestamp int64, eventID string, payload ThingInteractionEventPayload) error {
+	return DefaultClient().ThingIneraction(thingID, timestamp, eventID, payload)
+}
+
+// ThingIneraction is the same as the package level ThingIneraction, using the client's configuration
+func (client *Client) ThingIneraction(thingID string, timestamp int64, eventID string, payload ThingInteractionEventPayload) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
@@ -193,6 +257,11 @@ func ThingIneraction(thingID string, timestamp int64, eventID string, payload Th
 	}
 	payload["thing_id"] = thingID
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeThingInteraction, thingID, timestamp)
 	}
@@ -203,11 +272,16 @@ func ThingIneraction(thingID string, timestamp int64, eventID string, payload Th
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // ThingConnected tells Copilot that a thing has been connected
 func ThingConnected(thingID string, userID string, timestamp int64, eventID string) error {
+	return DefaultClient().ThingConnected(thingID, userID, timestamp, eventID)
+}
+
+// ThingConnected is the same as the package level ThingConnected, using the client's configuration
+func (client *Client) ThingConnected(thingID string, userID string, timestamp int64, eventID string) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
@@ -220,6 +294,11 @@ func ThingConnected(thingID string, userID string, timestamp int64, eventID stri
 		payload["user_id"] = userID
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeThingConnected, thingID, timestamp)
 	}
@@ -230,21 +309,53 @@ func ThingConnected(thingID string, userID string, timestamp int64, eventID stri
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // ThingConsumableUsage tells Copilot that the thing consumed something. For example, if the thing is a
 // printer and prints a sheet of paper, this function could be called to tell Copilot that the thing
 // consumed paper.
 func ThingConsumableUsage(thingID string, userID string, consumableType string, timestamp int64, eventID string) error {
+	return DefaultClient().ThingConsumableUsage(thingID, userID, consumableType, timestamp, eventID)
+}
+
+// ThingConsumableUsage is the same as the package level ThingConsumableUsage, using the client's configuration
+func (client *Client) ThingConsumableUsage(thingID string, userID string, consumableType string, timestamp int64, eventID string) error {
+	return client.thingConsumableUsageEvent(thingID, userID, consumableType, timestamp, eventID, nil)
+}
+
+// ThingConsumableUsageQuantity tells Copilot that the thing consumed a quantity of something, such as 25 grams of food.
+// The consumableType is required. The unit is optional but should be consistent for the same consumable type.
+func ThingConsumableUsageQuantity(thingID string, userID string, consumableType string, quantity float64, unit string, timestamp int64, eventID string) error {
+	return DefaultClient().ThingConsumableUsageQuantity(thingID, userID, consumableType, quantity, unit, timestamp, eventID)
+}
+
+// ThingConsumableUsageQuantity is the same as the package level ThingConsumableUsageQuantity, using the client's configuration
+func (client *Client) ThingConsumableUsageQuantity(thingID string, userID string, consumableType string, quantity float64, unit string, timestamp int64, eventID string) error {
+	if consumableType == "" {
+		return errors.New("consumableType cannot be blank")
+	}
+	additional := map[string]interface{}{
+		"quantity": quantity,
+	}
+	if unit != "" {
+		additional["unit"] = unit
+	}
+	return client.thingConsumableUsageEvent(thingID, userID, consumableType, timestamp, eventID, additional)
+}
+
+// thingConsumableUsageEvent sends the consumable usage event with any additional fields added to the payload
+func (client *Client) thingConsumableUsageEvent(thingID string, userID string, consumableType string, timestamp int64, eventID string, additional map[string]interface{}) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
 	}
 
-	payload := map[string]string{
-		"thing_id": thingID,
+	payload := map[string]interface{}{}
+	for key, value := range additional {
+		payload[key] = value
 	}
+	payload["thing_id"] = thingID
 	if userID != "" {
 		payload["user_id"] = userID
 	}
@@ -252,6 +363,11 @@ func ThingConsumableUsage(thingID string, userID string, consumableType string,
 		payload["consumable_type"] = consumableType
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeThingConsumableUsage, thingID, timestamp)
 	}
@@ -262,49 +378,42 @@ func ThingConsumableUsage(thingID string, userID string, consumableType string,
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // ThingFirmwareUpgradeStarted tells Copilot that a firmware upgrade has begin on the thing.
 func ThingFirmwareUpgradeStarted(thingID string, userID string, firmwareVersion string, timestamp int64, eventID string) error {
-	// basic error checking and set some defaults
-	if thingID == "" {
-		return errors.New("thingID cannot be blank")
-	}
-
-	payload := map[string]string{
-		"thing_id": thingID,
-	}
-	if userID != "" {
-		payload["user_id"] = userID
-	}
-	if firmwareVersion != "" {
-		payload["firmware_version"] = firmwareVersion
-	}
-
-	if eventID == "" {
-		eventID = eventIDHelper(EventTypeThingFirmwareUpgradeStarted, thingID, timestamp)
-	}
+	return DefaultClient().ThingFirmwareUpgradeStarted(thingID, userID, firmwareVersion, timestamp, eventID)
+}
 
-	event := Event{
-		EventID:   eventID,
-		Type:      EventTypeThingFirmwareUpgradeStarted,
-		Timestamp: timestamp,
-		Payload:   payload,
-	}
-	return event.sendEvent()
+// ThingFirmwareUpgradeStarted is the same as the package level ThingFirmwareUpgradeStarted, using the client's configuration
+func (client *Client) ThingFirmwareUpgradeStarted(thingID string, userID string, firmwareVersion string, timestamp int64, eventID string) error {
+	return client.thingFirmwareUpgradeEvent(EventTypeThingFirmwareUpgradeStarted, thingID, userID, firmwareVersion, timestamp, eventID, nil)
 }
 
 // ThingFirmwareUpgradeCompleted tells Copilot that a firmware upgrade has completed on the thing.
 func ThingFirmwareUpgradeCompleted(thingID string, userID string, firmwareVersion string, timestamp int64, eventID string) error {
+	return DefaultClient().ThingFirmwareUpgradeCompleted(thingID, userID, firmwareVersion, timestamp, eventID)
+}
+
+// ThingFirmwareUpgradeCompleted is the same as the package level ThingFirmwareUpgradeCompleted, using the client's configuration
+func (client *Client) ThingFirmwareUpgradeCompleted(thingID string, userID string, firmwareVersion string, timestamp int64, eventID string) error {
+	return client.thingFirmwareUpgradeEvent(EventTypeThingFirmwareUpgradeCompleted, thingID, userID, firmwareVersion, timestamp, eventID, nil)
+}
+
+// thingFirmwareUpgradeEvent sends either of the firmware upgrade events. Any additional fields, such as
+// those calculated by the FirmwareUpgradeTracker, are added to the payload.
+func (client *Client) thingFirmwareUpgradeEvent(eventType string, thingID string, userID string, firmwareVersion string, timestamp int64, eventID string, additional map[string]interface{}) error {
 	// basic error checking and set some defaults
 	if thingID == "" {
 		return errors.New("thingID cannot be blank")
 	}
 
-	payload := map[string]string{
-		"thing_id": thingID,
+	payload := map[string]interface{}{}
+	for key, value := range additional {
+		payload[key] = value
 	}
+	payload["thing_id"] = thingID
 	if userID != "" {
 		payload["user_id"] = userID
 	}
@@ -312,15 +421,20 @@ func ThingFirmwareUpgradeCompleted(thingID string, userID string, firmwareVersio
 		payload["firmware_version"] = firmwareVersion
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
-		eventID = eventIDHelper(EventTypeThingFirmwareUpgradeCompleted, thingID, timestamp)
+		eventID = eventIDHelper(eventType, thingID, timestamp)
 	}
 
 	event := Event{
 		EventID:   eventID,
-		Type:      EventTypeThingFirmwareUpgradeCompleted,
+		Type:      eventType,
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
@@ -0,0 +1,265 @@
+package copilot
+
+import (
+	"time"
+)
+
+// below are variants of each event call that take the timestamp as a time.Time instead of Unix milliseconds.
+// A zero time uses the current time from the configured Clock.
+
+// UserCreatedAt calls UserCreated with the timestamp taken from at
+func UserCreatedAt(userID string, at time.Time, eventID string, payload *UserEventPayload) error {
+	return DefaultClient().UserCreatedAt(userID, at, eventID, payload)
+}
+
+// UserCreatedAt calls UserCreated with the timestamp taken from at
+func (client *Client) UserCreatedAt(userID string, at time.Time, eventID string, payload *UserEventPayload) error {
+	return client.UserCreated(userID, Timestamp(at), eventID, payload)
+}
+
+// UserUpdatedAt calls UserUpdated with the timestamp taken from at
+func UserUpdatedAt(userID string, at time.Time, eventID string, payload *UserEventPayload) error {
+	return DefaultClient().UserUpdatedAt(userID, at, eventID, payload)
+}
+
+// UserUpdatedAt calls UserUpdated with the timestamp taken from at
+func (client *Client) UserUpdatedAt(userID string, at time.Time, eventID string, payload *UserEventPayload) error {
+	return client.UserUpdated(userID, Timestamp(at), eventID, payload)
+}
+
+// UserDeletedAt calls UserDeleted with the timestamp taken from at
+func UserDeletedAt(userID string, at time.Time, eventID string) error {
+	return DefaultClient().UserDeletedAt(userID, at, eventID)
+}
+
+// UserDeletedAt calls UserDeleted with the timestamp taken from at
+func (client *Client) UserDeletedAt(userID string, at time.Time, eventID string) error {
+	return client.UserDeleted(userID, Timestamp(at), eventID)
+}
+
+// ThingCreatedAt calls ThingCreated with the timestamp taken from at
+func ThingCreatedAt(thingID string, at time.Time, eventID string, payload *ThingCreatedUpdatedPayload) error {
+	return DefaultClient().ThingCreatedAt(thingID, at, eventID, payload)
+}
+
+// ThingCreatedAt calls ThingCreated with the timestamp taken from at
+func (client *Client) ThingCreatedAt(thingID string, at time.Time, eventID string, payload *ThingCreatedUpdatedPayload) error {
+	return client.ThingCreated(thingID, Timestamp(at), eventID, payload)
+}
+
+// ThingUpdatedAt calls ThingUpdated with the timestamp taken from at
+func ThingUpdatedAt(thingID string, at time.Time, eventID string, payload *ThingCreatedUpdatedPayload) error {
+	return DefaultClient().ThingUpdatedAt(thingID, at, eventID, payload)
+}
+
+// ThingUpdatedAt calls ThingUpdated with the timestamp taken from at
+func (client *Client) ThingUpdatedAt(thingID string, at time.Time, eventID string, payload *ThingCreatedUpdatedPayload) error {
+	return client.ThingUpdated(thingID, Timestamp(at), eventID, payload)
+}
+
+// ThingAssociatedAt calls ThingAssociated with the timestamp taken from at
+func ThingAssociatedAt(thingID string, userID string, at time.Time, eventID string) error {
+	return DefaultClient().ThingAssociatedAt(thingID, userID, at, eventID)
+}
+
+// ThingAssociatedAt calls ThingAssociated with the timestamp taken from at
+func (client *Client) ThingAssociatedAt(thingID string, userID string, at time.Time, eventID string) error {
+	return client.ThingAssociated(thingID, userID, Timestamp(at), eventID)
+}
+
+// ThingDisassociatedAt calls ThingDisassociated with the timestamp taken from at
+func ThingDisassociatedAt(thingID string, userID string, at time.Time, eventID string) error {
+	return DefaultClient().ThingDisassociatedAt(thingID, userID, at, eventID)
+}
+
+// ThingDisassociatedAt calls ThingDisassociated with the timestamp taken from at
+func (client *Client) ThingDisassociatedAt(thingID string, userID string, at time.Time, eventID string) error {
+	return client.ThingDisassociated(thingID, userID, Timestamp(at), eventID)
+}
+
+// ThingStatusChangedAt calls ThingStatusChanged with the timestamp taken from at
+func ThingStatusChangedAt(thingID string, at time.Time, eventID string, payload *ThingStatusChangedPayload) error {
+	return DefaultClient().ThingStatusChangedAt(thingID, at, eventID, payload)
+}
+
+// ThingStatusChangedAt calls ThingStatusChanged with the timestamp taken from at
+func (client *Client) ThingStatusChangedAt(thingID string, at time.Time, eventID string, payload *ThingStatusChangedPayload) error {
+	return client.ThingStatusChanged(thingID, Timestamp(at), eventID, payload)
+}
+
+// ThingIneractionAt calls ThingIneraction with the timestamp taken from at
+func ThingIneractionAt(thingID string, at time.Time, eventID string, payload ThingInteractionEventPayload) error {
+	return DefaultClient().ThingIneractionAt(thingID, at, eventID, payload)
+}
+
+// ThingIneractionAt calls ThingIneraction with the timestamp taken from at
+func (client *Client) ThingIneractionAt(thingID string, at time.Time, eventID string, payload ThingInteractionEventPayload) error {
+	return client.ThingIneraction(thingID, Timestamp(at), eventID, payload)
+}
+
+// ThingConnectedAt calls ThingConnected with the timestamp taken from at
+func ThingConnectedAt(thingID string, userID string, at time.Time, eventID string) error {
+	return DefaultClient().ThingConnectedAt(thingID, userID, at, eventID)
+}
+
+// ThingConnectedAt calls ThingConnected with the timestamp taken from at
+func (client *Client) ThingConnectedAt(thingID string, userID string, at time.Time, eventID string) error {
+	return client.ThingConnected(thingID, userID, Timestamp(at), eventID)
+}
+
+// ThingConsumableUsageAt calls ThingConsumableUsage with the timestamp taken from at
+func ThingConsumableUsageAt(thingID string, userID string, consumableType string, at time.Time, eventID string) error {
+	return DefaultClient().ThingConsumableUsageAt(thingID, userID, consumableType, at, eventID)
+}
+
+// ThingConsumableUsageAt calls ThingConsumableUsage with the timestamp taken from at
+func (client *Client) ThingConsumableUsageAt(thingID string, userID string, consumableType string, at time.Time, eventID string) error {
+	return client.ThingConsumableUsage(thingID, userID, consumableType, Timestamp(at), eventID)
+}
+
+// ThingConsumableUsageQuantityAt calls ThingConsumableUsageQuantity with the timestamp taken from at
+func ThingConsumableUsageQuantityAt(thingID string, userID string, consumableType string, quantity float64, unit string, at time.Time, eventID string) error {
+	return DefaultClient().ThingConsumableUsageQuantityAt(thingID, userID, consumableType, quantity, unit, at, eventID)
+}
+
+// ThingConsumableUsageQuantityAt calls ThingConsumableUsageQuantity with the timestamp taken from at
+func (client *Client) ThingConsumableUsageQuantityAt(thingID string, userID string, consumableType string, quantity float64, unit string, at time.Time, eventID string) error {
+	return client.ThingConsumableUsageQuantity(thingID, userID, consumableType, quantity, unit, Timestamp(at), eventID)
+}
+
+// ThingFirmwareUpgradeStartedAt calls ThingFirmwareUpgradeStarted with the timestamp taken from at
+func ThingFirmwareUpgradeStartedAt(thingID string, userID string, firmwareVersion string, at time.Time, eventID string) error {
+	return DefaultClient().ThingFirmwareUpgradeStartedAt(thingID, userID, firmwareVersion, at, eventID)
+}
+
+// ThingFirmwareUpgradeStartedAt calls ThingFirmwareUpgradeStarted with the timestamp taken from at
+func (client *Client) ThingFirmwareUpgradeStartedAt(thingID string, userID string, firmwareVersion string, at time.Time, eventID string) error {
+	return client.ThingFirmwareUpgradeStarted(thingID, userID, firmwareVersion, Timestamp(at), eventID)
+}
+
+// ThingFirmwareUpgradeCompletedAt calls ThingFirmwareUpgradeCompleted with the timestamp taken from at
+func ThingFirmwareUpgradeCompletedAt(thingID string, userID string, firmwareVersion string, at time.Time, eventID string) error {
+	return DefaultClient().ThingFirmwareUpgradeCompletedAt(thingID, userID, firmwareVersion, at, eventID)
+}
+
+// ThingFirmwareUpgradeCompletedAt calls ThingFirmwareUpgradeCompleted with the timestamp taken from at
+func (client *Client) ThingFirmwareUpgradeCompletedAt(thingID string, userID string, firmwareVersion string, at time.Time, eventID string) error {
+	return client.ThingFirmwareUpgradeCompleted(thingID, userID, firmwareVersion, Timestamp(at), eventID)
+}
+
+// CustomEventAt calls CustomEvent with the timestamp taken from at
+func CustomEventAt(eventSubtype string, at time.Time, eventID string, payload CustomEventPayload) error {
+	return DefaultClient().CustomEventAt(eventSubtype, at, eventID, payload)
+}
+
+// CustomEventAt calls CustomEvent with the timestamp taken from at
+func (client *Client) CustomEventAt(eventSubtype string, at time.Time, eventID string, payload CustomEventPayload) error {
+	return client.CustomEvent(eventSubtype, Timestamp(at), eventID, payload)
+}
+
+// UnsubscribeUserEmailAt calls UnsubscribeUserEmail with the timestamp taken from at
+func UnsubscribeUserEmailAt(email string, at time.Time, eventID string) error {
+	return DefaultClient().UnsubscribeUserEmailAt(email, at, eventID)
+}
+
+// UnsubscribeUserEmailAt calls UnsubscribeUserEmail with the timestamp taken from at
+func (client *Client) UnsubscribeUserEmailAt(email string, at time.Time, eventID string) error {
+	return client.UnsubscribeUserEmail(email, Timestamp(at), eventID)
+}
+
+// SyncStartedAt calls SyncStarted with the timestamp taken from at
+func SyncStartedAt(at time.Time, eventID string) error {
+	return DefaultClient().SyncStartedAt(at, eventID)
+}
+
+// SyncStartedAt calls SyncStarted with the timestamp taken from at
+func (client *Client) SyncStartedAt(at time.Time, eventID string) error {
+	return client.SyncStarted(Timestamp(at), eventID)
+}
+
+// SyncCompletedAt calls SyncCompleted with the timestamp taken from at
+func SyncCompletedAt(at time.Time, eventID string) error {
+	return DefaultClient().SyncCompletedAt(at, eventID)
+}
+
+// SyncCompletedAt calls SyncCompleted with the timestamp taken from at
+func (client *Client) SyncCompletedAt(at time.Time, eventID string) error {
+	return client.SyncCompleted(Timestamp(at), eventID)
+}
+
+// PreexistingUserCreatedAt calls PreexistingUserCreated with the timestamp taken from at
+func PreexistingUserCreatedAt(userID string, at time.Time, eventID string, payload *PreexistingUserEventPayload) error {
+	return DefaultClient().PreexistingUserCreatedAt(userID, at, eventID, payload)
+}
+
+// PreexistingUserCreatedAt calls PreexistingUserCreated with the timestamp taken from at
+func (client *Client) PreexistingUserCreatedAt(userID string, at time.Time, eventID string, payload *PreexistingUserEventPayload) error {
+	return client.PreexistingUserCreated(userID, Timestamp(at), eventID, payload)
+}
+
+// PreexistingThingCreatedAt calls PreexistingThingCreated with the timestamp taken from at
+func PreexistingThingCreatedAt(thingID string, at time.Time, eventID string, payload *PreexistingThingCreatedPayload) error {
+	return DefaultClient().PreexistingThingCreatedAt(thingID, at, eventID, payload)
+}
+
+// PreexistingThingCreatedAt calls PreexistingThingCreated with the timestamp taken from at
+func (client *Client) PreexistingThingCreatedAt(thingID string, at time.Time, eventID string, payload *PreexistingThingCreatedPayload) error {
+	return client.PreexistingThingCreated(thingID, Timestamp(at), eventID, payload)
+}
+
+// PreexistingThingUserAssociatedAt calls PreexistingThingUserAssociated with the timestamp taken from at
+func PreexistingThingUserAssociatedAt(thingID string, userID string, at time.Time, eventID string, originalAssociationDate int64) error {
+	return DefaultClient().PreexistingThingUserAssociatedAt(thingID, userID, at, eventID, originalAssociationDate)
+}
+
+// PreexistingThingUserAssociatedAt calls PreexistingThingUserAssociated with the timestamp taken from at
+func (client *Client) PreexistingThingUserAssociatedAt(thingID string, userID string, at time.Time, eventID string, originalAssociationDate int64) error {
+	return client.PreexistingThingUserAssociated(thingID, userID, Timestamp(at), eventID, originalAssociationDate)
+}
+
+// TransferThingAt calls TransferThing with the timestamp taken from at
+func TransferThingAt(thingID string, fromUserID string, toUserID string, at time.Time, compensate bool) error {
+	return DefaultClient().TransferThingAt(thingID, fromUserID, toUserID, at, compensate)
+}
+
+// TransferThingAt calls TransferThing with the timestamp taken from at
+func (client *Client) TransferThingAt(thingID string, fromUserID string, toUserID string, at time.Time, compensate bool) error {
+	return client.TransferThing(thingID, fromUserID, toUserID, Timestamp(at), compensate)
+}
+
+// ReplaceThingAt calls ReplaceThing with the timestamp taken from at
+func ReplaceThingAt(oldThingID string, newThingID string, at time.Time, payload *ThingReplacementPayload) error {
+	return DefaultClient().ReplaceThingAt(oldThingID, newThingID, at, payload)
+}
+
+// ReplaceThingAt calls ReplaceThing with the timestamp taken from at
+func (client *Client) ReplaceThingAt(oldThingID string, newThingID string, at time.Time, payload *ThingReplacementPayload) error {
+	return client.ReplaceThing(oldThingID, newThingID, Timestamp(at), payload)
+}
+
+// MergeUsersAt calls MergeUsers with the timestamp taken from at
+func MergeUsersAt(anonymousID string, realID string, at time.Time, payload *UserEventPayload, deleteAnonymous bool) error {
+	return DefaultClient().MergeUsersAt(anonymousID, realID, at, payload, deleteAnonymous)
+}
+
+// MergeUsersAt calls MergeUsers with the timestamp taken from at
+func (client *Client) MergeUsersAt(anonymousID string, realID string, at time.Time, payload *UserEventPayload, deleteAnonymous bool) error {
+	return client.MergeUsers(anonymousID, realID, Timestamp(at), payload, deleteAnonymous)
+}
+
+// UpdateUserConsentAt calls UpdateUserConsent as of at, so that the user ID is pseudonymized the same way as
+// events sent with the same time when the privacy policy rotates pseudonyms
+func UpdateUserConsentAt(userID string, consentValue bool, at time.Time) error {
+	return DefaultClient().UpdateUserConsentAt(userID, consentValue, at)
+}
+
+// UpdateUserConsentAt calls UpdateUserConsent as of at, so that the user ID is pseudonymized the same way as
+// events sent with the same time when the privacy policy rotates pseudonyms
+func (client *Client) UpdateUserConsentAt(userID string, consentValue bool, at time.Time) error {
+	return client.updateUserConsent(userID, consentValue, Timestamp(at))
+}
+
+// SendCustomAt calls SendCustom with the timestamp taken from at
+func SendCustomAt[T any](at time.Time, eventID string, payload T) error {
+	return SendCustom(Timestamp(at), eventID, payload)
+}
@@ -0,0 +1,117 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TransferError is returned by TransferThing when Copilot accepted only one of the two events, leaving its view
+// of the thing inconsistent unless the accepted event was compensated
+type TransferError struct {
+	ThingID    string
+	FromUserID string
+	ToUserID   string
+	// Disassociated and Associated are true for the events Copilot accepted
+	Disassociated bool
+	Associated    bool
+	// Compensated is true when the accepted event was undone, so the thing is still associated to the original user
+	Compensated bool
+	// CompensationErr is the error from undoing the accepted event, if compensation was attempted and failed
+	CompensationErr error
+	// Err is the error for the event that was rejected
+	Err error
+}
+
+func (err *TransferError) Error() string {
+	message := fmt.Sprintf("transfer of %s from %s to %s was only partly accepted (disassociated: %t, associated: %t): %v",
+		err.ThingID, err.FromUserID, err.ToUserID, err.Disassociated, err.Associated, err.Err)
+	if err.Compensated {
+		message += "; the accepted event was compensated"
+	} else if err.CompensationErr != nil {
+		message += fmt.Sprintf("; compensation failed: %v", err.CompensationErr)
+	}
+	return message
+}
+
+func (err *TransferError) Unwrap() error {
+	return err.Err
+}
+
+// TransferThing tells Copilot that a thing has moved from one user to another, such as when it is resold. The
+// ThingDisassociated and ThingAssociated events are sent together in a single request, in that order, with the
+// association one millisecond after the disassociation so the order also holds when sorted by time. If the
+// request fails or both events are rejected, nothing changed and the error is returned. If only one was accepted,
+// a *TransferError is returned, and when compensate is true the accepted event is undone first so that the thing
+// stays with the original user.
+func TransferThing(thingID string, fromUserID string, toUserID string, timestamp int64, compensate bool) error {
+	return DefaultClient().TransferThing(thingID, fromUserID, toUserID, timestamp, compensate)
+}
+
+// TransferThing is the same as the package level TransferThing, using the client's configuration
+func (client *Client) TransferThing(thingID string, fromUserID string, toUserID string, timestamp int64, compensate bool) error {
+	if fromUserID == toUserID {
+		return errors.New("fromUserID and toUserID cannot be the same")
+	}
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	disassociated, err := client.associationEvent(EventTypeThingDisassociated, thingID, fromUserID, timestamp,
+		uniqueEventID(EventTypeThingDisassociated, timestamp, thingID, fromUserID))
+	if err != nil {
+		return err
+	}
+	associated, err := client.associationEvent(EventTypeThingAssociated, thingID, toUserID, timestamp+1,
+		uniqueEventID(EventTypeThingAssociated, timestamp+1, thingID, toUserID))
+	if err != nil {
+		return err
+	}
+
+	rejected, err := client.sendEvents([]Event{disassociated, associated})
+	if err != nil {
+		return err
+	}
+	if len(rejected) == 2 {
+		return rejected[0]
+	}
+	if _, found := rejected[0]; !found {
+		if err := client.recordAssociation(thingID, fromUserID, false); err != nil {
+			return err
+		}
+	}
+	if _, found := rejected[1]; !found {
+		if err := client.recordAssociation(thingID, toUserID, true); err != nil {
+			return err
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	transferErr := &TransferError{
+		ThingID:       thingID,
+		FromUserID:    fromUserID,
+		ToUserID:      toUserID,
+		Disassociated: rejected[0] == nil,
+		Associated:    rejected[1] == nil,
+	}
+	if transferErr.Disassociated {
+		transferErr.Err = rejected[1]
+	} else {
+		transferErr.Err = rejected[0]
+	}
+	if compensate {
+		// undo the accepted event after both of the transfer's events, with an ID that cannot match the
+		// rejected event's even for long thing IDs
+		immediate := client.immediately()
+		if transferErr.Disassociated {
+			eventID := uniqueEventID(EventTypeThingAssociated, timestamp+2, thingID, fromUserID, "compensation")
+			transferErr.CompensationErr = immediate.ThingAssociated(thingID, fromUserID, timestamp+2, eventID)
+		} else {
+			eventID := uniqueEventID(EventTypeThingDisassociated, timestamp+2, thingID, toUserID, "compensation")
+			transferErr.CompensationErr = immediate.ThingDisassociated(thingID, toUserID, timestamp+2, eventID)
+		}
+		transferErr.Compensated = transferErr.CompensationErr == nil
+	}
+	return transferErr
+}
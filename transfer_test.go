@@ -0,0 +1,95 @@
+package copilot_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferThing(t *testing.T) {
+	associations := copilot.NewMemoryAssociationStore()
+	// the blocked user cannot have things associated to them, and the stuck user cannot have them disassociated
+	recorder := copilottest.NewRecorder(copilot.WithAssociationStore(associations),
+		copilot.WithDryRunValidator(func(event copilot.Event) string {
+			payload := event.Payload.(map[string]interface{})
+			if event.Type == copilot.EventTypeThingAssociated && payload["user_id"] == "blocked" {
+				return "user is blocked"
+			}
+			if event.Type == copilot.EventTypeThingDisassociated && payload["user_id"] == "stuck" {
+				return "user is stuck"
+			}
+			return ""
+		}))
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "user-1", 0, ""))
+	recorder.Reset()
+
+	err := recorder.TransferThing("thing-1", "user-1", "user-2", 1600000000000, false)
+	assert.Nil(t, err)
+	records := recorder.Records()
+	assert.Len(t, records, 1)
+	assert.Len(t, records[0].Events, 2)
+	assert.Equal(t, copilot.EventTypeThingDisassociated, records[0].Events[0].Type)
+	assert.Equal(t, int64(1600000000000), records[0].Events[0].Timestamp)
+	assert.Equal(t, copilot.EventTypeThingAssociated, records[0].Events[1].Type)
+	assert.Equal(t, int64(1600000000001), records[0].Events[1].Timestamp)
+	users, err := associations.UsersForThing("thing-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-2"}, users)
+
+	// a partial transfer is reported and left as is
+	err = recorder.TransferThing("thing-1", "user-2", "blocked", 0, false)
+	transferErr := &copilot.TransferError{}
+	assert.True(t, errors.As(err, &transferErr))
+	assert.True(t, transferErr.Disassociated)
+	assert.False(t, transferErr.Associated)
+	assert.False(t, transferErr.Compensated)
+	invalid := &copilot.InvalidEventError{}
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "user is blocked", invalid.EventError)
+	users, err = associations.UsersForThing("thing-1")
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+
+	// compensation puts the thing back with the original user
+	assert.Nil(t, recorder.ThingAssociated("thing-1", "user-2", 0, ""))
+	recorder.Reset()
+	err = recorder.TransferThing("thing-1", "user-2", "blocked", 0, true)
+	assert.True(t, errors.As(err, &transferErr))
+	assert.True(t, transferErr.Compensated)
+	assert.Len(t, recorder.Records(), 2)
+	recorder.AssertEmitted(t, copilot.EventTypeThingAssociated, "user-2", map[string]interface{}{"thing_id": "thing-1"})
+	users, err = associations.UsersForThing("thing-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-2"}, users)
+
+	// with long thing IDs, the compensation's event ID still differs from the rejected event's
+	thingID := "3f2b8c1e-9a4d-4c1b-8e2f-123456789abc"
+	assert.Nil(t, recorder.ThingAssociated(thingID, "stuck", 0, ""))
+	recorder.Reset()
+	err = recorder.TransferThing(thingID, "stuck", "user-2", 0, true)
+	assert.True(t, errors.As(err, &transferErr))
+	assert.False(t, transferErr.Disassociated)
+	assert.True(t, transferErr.Compensated)
+	ids := map[string]bool{}
+	for _, event := range recorder.Events() {
+		assert.LessOrEqual(t, len(event.EventID), 50)
+		ids[event.EventID] = true
+	}
+	assert.Len(t, ids, 3)
+	recorder.AssertEmitted(t, copilot.EventTypeThingDisassociated, "user-2", map[string]interface{}{"thing_id": thingID})
+
+	// a failed request changes nothing
+	recorder.FailNext(errors.New("copilot is down"))
+	err = recorder.TransferThing("thing-1", "user-2", "user-3", 0, true)
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &transferErr))
+	users, err = associations.UsersForThing("thing-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-2"}, users)
+
+	assert.NotNil(t, recorder.TransferThing("thing-1", "user-2", "user-2", 0, false))
+	assert.NotNil(t, recorder.TransferThing("", "user-2", "user-3", 0, false))
+}
@@ -0,0 +1,183 @@
+package copilot
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// defaultTimeout is the timeout for collect and consent calls when none is configured
+const defaultTimeout = 5 * time.Second
+
+// transportSettings are the options used to build the http.Transport when the caller does not supply one
+type transportSettings struct {
+	proxy               *url.URL
+	rootCAs             [][]byte
+	certificates        []tls.Certificate
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	configured          bool
+}
+
+// WithHTTPClient sends every request with the client. Its Timeout is used for both collect and consent calls
+// unless WithTimeouts is also passed. It cannot be combined with the proxy, certificate or pooling options.
+func WithHTTPClient(client *http.Client) Option {
+	return func(config *configStruct) {
+		config.HTTPClient = client
+	}
+}
+
+// WithTransport sends every request with the round tripper. It cannot be combined with the proxy, certificate
+// or pooling options.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(config *configStruct) {
+		config.Transport = transport
+	}
+}
+
+// WithProxy sends every request through the proxy, such as http://proxy.internal:3128, instead of using the
+// HTTP_PROXY and HTTPS_PROXY environment variables
+func WithProxy(proxyURL string) Option {
+	return func(config *configStruct) {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			config.optionErrors = append(config.optionErrors, fmt.Errorf("proxy url is invalid: %w", err))
+			return
+		}
+		config.transport.proxy = parsed
+		config.transport.configured = true
+	}
+}
+
+// WithRootCAs trusts the PEM encoded certificates in the files, in addition to the system roots, such as for
+// a proxy that uses a private certificate authority
+func WithRootCAs(pemFiles ...string) Option {
+	return func(config *configStruct) {
+		for _, pemFile := range pemFiles {
+			data, err := os.ReadFile(pemFile)
+			if err != nil {
+				config.optionErrors = append(config.optionErrors, fmt.Errorf("root ca could not be read: %w", err))
+				continue
+			}
+			config.transport.rootCAs = append(config.transport.rootCAs, data)
+		}
+		config.transport.configured = true
+	}
+}
+
+// WithClientCertificate presents the certificate and key, both PEM encoded files, for mutual TLS
+func WithClientCertificate(certFile string, keyFile string) Option {
+	return func(config *configStruct) {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			config.optionErrors = append(config.optionErrors, fmt.Errorf("client certificate could not be loaded: %w", err))
+			return
+		}
+		config.transport.certificates = append(config.transport.certificates, certificate)
+		config.transport.configured = true
+	}
+}
+
+// WithConnectionPool tunes how many idle connections are kept open, in total and per host, and for how long.
+// Zero values keep the defaults from http.DefaultTransport.
+func WithConnectionPool(maxIdleConns int, maxIdleConnsPerHost int, idleConnTimeout time.Duration) Option {
+	return func(config *configStruct) {
+		config.transport.maxIdleConns = maxIdleConns
+		config.transport.maxIdleConnsPerHost = maxIdleConnsPerHost
+		config.transport.idleConnTimeout = idleConnTimeout
+		config.transport.configured = true
+	}
+}
+
+// WithTimeouts sets the timeouts of collect and consent calls separately; both default to 5 seconds. A zero
+// value keeps the default.
+func WithTimeouts(collectTimeout time.Duration, consentTimeout time.Duration) Option {
+	return func(config *configStruct) {
+		config.CollectTimeout = collectTimeout
+		config.ConsentTimeout = consentTimeout
+	}
+}
+
+// buildHTTPClients creates the clients used for collect and consent calls from the options
+func (config *configStruct) buildHTTPClients() error {
+	if config.transport.configured && (config.HTTPClient != nil || config.Transport != nil) {
+		return errors.New("the proxy, certificate and pooling options cannot be combined with WithHTTPClient or WithTransport")
+	}
+
+	base := &http.Client{
+		Timeout: defaultTimeout,
+	}
+	if config.HTTPClient != nil {
+		copied := *config.HTTPClient
+		base = &copied
+	}
+	if config.Transport != nil {
+		base.Transport = config.Transport
+	}
+	if config.transport.configured {
+		transport, err := config.transport.build()
+		if err != nil {
+			return err
+		}
+		base.Transport = transport
+	}
+
+	collect := *base
+	if config.CollectTimeout > 0 {
+		collect.Timeout = config.CollectTimeout
+	}
+	consent := *base
+	if config.ConsentTimeout > 0 {
+		consent.Timeout = config.ConsentTimeout
+	}
+	config.collectHTTP = &collect
+	config.consentHTTP = &consent
+	return nil
+}
+
+// build clones the default transport and applies the settings
+func (settings transportSettings) build() (*http.Transport, error) {
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("http.DefaultTransport has been replaced and cannot be configured")
+	}
+	transport := defaultTransport.Clone()
+	if settings.proxy != nil {
+		transport.Proxy = http.ProxyURL(settings.proxy)
+	}
+	if settings.maxIdleConns > 0 {
+		transport.MaxIdleConns = settings.maxIdleConns
+	}
+	if settings.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = settings.maxIdleConnsPerHost
+	}
+	if settings.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = settings.idleConnTimeout
+	}
+	if len(settings.rootCAs) > 0 || len(settings.certificates) > 0 {
+		tlsConfig := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: settings.certificates,
+		}
+		if len(settings.rootCAs) > 0 {
+			pool, err := x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+			for _, pem := range settings.rootCAs {
+				if !pool.AppendCertsFromPEM(pem) {
+					return nil, errors.New("root ca does not contain any PEM encoded certificates")
+				}
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
@@ -0,0 +1,129 @@
+package copilot_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeClientCertificate generates a self-signed client certificate and key and writes them as PEM files
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "copilot-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTransportTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"invalid_events":[]}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	assert.Nil(t, err)
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	// the server's certificate is not trusted by default
+	client, err := copilot.NewClient("id", "secret", server.URL, "")
+	assert.Nil(t, err)
+	assert.NotNil(t, client.UserDeleted("user-1", 0, ""))
+
+	// without a client certificate, the server refuses the request
+	client, err = copilot.NewClient("id", "secret", server.URL, "", copilot.WithRootCAs(caFile))
+	assert.Nil(t, err)
+	assert.NotNil(t, client.UserDeleted("user-1", 0, ""))
+
+	client, err = copilot.NewClient("id", "secret", server.URL, "", copilot.WithRootCAs(caFile),
+		copilot.WithClientCertificate(certFile, keyFile), copilot.WithConnectionPool(10, 2, time.Minute))
+	assert.Nil(t, err)
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+
+	// option errors are returned when the client is created
+	_, err = copilot.NewClient("id", "secret", server.URL, "", copilot.WithRootCAs(filepath.Join(dir, "missing.pem")))
+	assert.NotNil(t, err)
+	_, err = copilot.NewClient("id", "secret", server.URL, "", copilot.WithClientCertificate(caFile, caFile))
+	assert.NotNil(t, err)
+	_, err = copilot.NewClient("id", "secret", server.URL, "", copilot.WithRootCAs(caFile), copilot.WithHTTPClient(&http.Client{}))
+	assert.NotNil(t, err)
+}
+
+func TestTransportProxyAndTimeouts(t *testing.T) {
+	proxied := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Host)
+		if r.URL.Path == "/consent" {
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"invalid_events":[]}`))
+	}))
+	defer proxy.Close()
+
+	_, err := copilot.NewClient("id", "secret", "http://copilot.invalid/collect", "", copilot.WithProxy("://bad"))
+	assert.NotNil(t, err)
+
+	client, err := copilot.NewClient("id", "secret", "http://copilot.invalid/collect", "http://copilot.invalid/consent",
+		copilot.WithProxy(proxy.URL), copilot.WithTimeouts(time.Second, 10*time.Millisecond))
+	assert.Nil(t, err)
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+	assert.Equal(t, []string{"copilot.invalid"}, proxied)
+	// the consent timeout is shorter than the proxy takes to respond
+	assert.NotNil(t, client.UpdateUserConsent("user-1", true))
+
+	// a custom round tripper is used as is
+	client, err = copilot.NewClient("id", "secret", "http://copilot.invalid/collect", "",
+		copilot.WithHTTPClient(&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(nil)}}),
+		copilot.WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			recorder := httptest.NewRecorder()
+			recorder.Write([]byte(`{"invalid_events":[]}`))
+			return recorder.Result(), nil
+		})))
+	assert.Nil(t, err)
+	assert.Nil(t, client.UserDeleted("user-1", 0, ""))
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
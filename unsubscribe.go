@@ -0,0 +1,271 @@
+package copilot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrUnsubscribeLinkInvalid is returned when an unsubscribe link is missing a value or its signature does not match
+var ErrUnsubscribeLinkInvalid = errors.New("unsubscribe link is invalid")
+
+// ErrUnsubscribeLinkExpired is returned when an unsubscribe link is past its expiration
+var ErrUnsubscribeLinkExpired = errors.New("unsubscribe link has expired")
+
+// UnsubscribeSigner generates and verifies HMAC signed, expiring unsubscribe links
+type UnsubscribeSigner struct {
+	key     []byte
+	baseURL *url.URL
+	ttl     time.Duration
+	// Clock is used for the expiration of links; if nil, the system time is used
+	Clock Clock
+}
+
+// UnsubscribeLink is a verified unsubscribe link
+type UnsubscribeLink struct {
+	Email   string
+	Nonce   string
+	Expires time.Time
+}
+
+// NewUnsubscribeSigner creates a signer for links to the base URL, which should be where the UnsubscribeHandler
+// is served. Links expire after the ttl. The key should be at least 32 random bytes and kept secret.
+func NewUnsubscribeSigner(key []byte, baseURL string, ttl time.Duration) (*UnsubscribeSigner, error) {
+	if len(key) == 0 {
+		return nil, errors.New("key cannot be blank")
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.IsAbs() {
+		return nil, errors.New("baseURL must be an absolute URL")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+	return &UnsubscribeSigner{
+		key:     key,
+		baseURL: parsed,
+		ttl:     ttl,
+	}, nil
+}
+
+// URL generates a signed unsubscribe link for the email
+func (signer *UnsubscribeSigner) URL(email string) (string, error) {
+	if email == "" {
+		return "", errors.New("email cannot be blank")
+	}
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	link := UnsubscribeLink{
+		Email:   email,
+		Nonce:   base64.RawURLEncoding.EncodeToString(nonce),
+		Expires: signer.now().Add(signer.ttl),
+	}
+
+	values := signer.baseURL.Query()
+	values.Set("email", link.Email)
+	values.Set("nonce", link.Nonce)
+	values.Set("expires", strconv.FormatInt(link.Expires.Unix(), 10))
+	values.Set("signature", signer.sign(link))
+	linkURL := *signer.baseURL
+	linkURL.RawQuery = values.Encode()
+	return linkURL.String(), nil
+}
+
+// Headers generates the List-Unsubscribe and List-Unsubscribe-Post headers for an email, as described in
+// RFC 8058, so that mail clients can offer one-click unsubscribe
+func (signer *UnsubscribeSigner) Headers(email string) (map[string]string, error) {
+	link, err := signer.URL(email)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}, nil
+}
+
+// Verify checks the signature and expiration of the link's query values
+func (signer *UnsubscribeSigner) Verify(values url.Values) (*UnsubscribeLink, error) {
+	email := values.Get("email")
+	nonce := values.Get("nonce")
+	expires, err := strconv.ParseInt(values.Get("expires"), 10, 64)
+	if email == "" || nonce == "" || err != nil {
+		return nil, ErrUnsubscribeLinkInvalid
+	}
+	link := &UnsubscribeLink{
+		Email:   email,
+		Nonce:   nonce,
+		Expires: time.Unix(expires, 0),
+	}
+	if !hmac.Equal([]byte(signer.sign(*link)), []byte(values.Get("signature"))) {
+		return nil, ErrUnsubscribeLinkInvalid
+	}
+	if !signer.now().Before(link.Expires) {
+		return nil, ErrUnsubscribeLinkExpired
+	}
+	return link, nil
+}
+
+func (signer *UnsubscribeSigner) sign(link UnsubscribeLink) string {
+	mac := hmac.New(sha256.New, signer.key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", link.Email, link.Nonce, link.Expires.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (signer *UnsubscribeSigner) now() time.Time {
+	if signer.Clock == nil {
+		return time.Now()
+	}
+	return signer.Clock.Now()
+}
+
+// ReplayStore remembers which unsubscribe links have been used so that each is only acted on once
+type ReplayStore interface {
+	// MarkUsed records the nonce until it expires, returning false if it had already been used
+	MarkUsed(nonce string, expires time.Time) (bool, error)
+	// Forget removes the nonce, so the link can be used again if acting on it failed
+	Forget(nonce string) error
+}
+
+// MemoryReplayStore is an in-memory ReplayStore. Used nonces are dropped once their links expire. When more
+// than one process serves the handler, a shared store should be used instead.
+type MemoryReplayStore struct {
+	lock  sync.Mutex
+	used  map[string]time.Time
+	clock Clock
+}
+
+// NewMemoryReplayStore creates an empty in-memory replay store
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{
+		used:  map[string]time.Time{},
+		clock: systemClock{},
+	}
+}
+
+// MarkUsed records the nonce until it expires, returning false if it had already been used
+func (store *MemoryReplayStore) MarkUsed(nonce string, expires time.Time) (bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	now := store.clock.Now()
+	for used, usedExpires := range store.used {
+		if !now.Before(usedExpires) {
+			delete(store.used, used)
+		}
+	}
+	if _, found := store.used[nonce]; found {
+		return false, nil
+	}
+	store.used[nonce] = expires
+	return true, nil
+}
+
+// Forget removes the nonce
+func (store *MemoryReplayStore) Forget(nonce string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.used, nonce)
+	return nil
+}
+
+// UnsubscribeHandler serves the links generated by an UnsubscribeSigner. A GET shows a confirmation page, so that
+// link scanners do not unsubscribe anyone, and a POST, including the RFC 8058 one-click POST sent by mail clients,
+// verifies the link and calls UnsubscribeUserEmail. Each link is only acted on once.
+type UnsubscribeHandler struct {
+	Signer *UnsubscribeSigner
+	// Replay defaults to a MemoryReplayStore
+	Replay ReplayStore
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+	// ConfirmTemplate and DoneTemplate replace the default pages. They are executed with the UnsubscribeLink.
+	ConfirmTemplate *template.Template
+	DoneTemplate    *template.Template
+
+	once sync.Once
+}
+
+var defaultUnsubscribeConfirmTemplate = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body><form method="post"><p>Unsubscribe {{.Email}} from these emails?</p><button type="submit">Unsubscribe</button></form></body></html>
+`))
+
+var defaultUnsubscribeDoneTemplate = template.Must(template.New("done").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribed</title></head>
+<body><p>{{.Email}} has been unsubscribed.</p></body></html>
+`))
+
+// ServeHTTP verifies the link and either confirms or performs the unsubscribe
+func (handler *UnsubscribeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler.once.Do(func() {
+		if handler.Replay == nil {
+			handler.Replay = NewMemoryReplayStore()
+		}
+		if handler.ConfirmTemplate == nil {
+			handler.ConfirmTemplate = defaultUnsubscribeConfirmTemplate
+		}
+		if handler.DoneTemplate == nil {
+			handler.DoneTemplate = defaultUnsubscribeDoneTemplate
+		}
+	})
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if handler.Signer == nil {
+		http.Error(w, "unsubscribe is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	// the signed values are always in the query string; a one-click POST body only holds List-Unsubscribe=One-Click
+	link, err := handler.Signer.Verify(r.URL.Query())
+	if errors.Is(err, ErrUnsubscribeLinkExpired) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodGet {
+		handler.ConfirmTemplate.Execute(w, link)
+		return
+	}
+
+	firstUse, err := handler.Replay.MarkUsed(link.Nonce, link.Expires)
+	if err != nil {
+		log.Printf("copilot unsubscribe link could not be checked: %v", err)
+		http.Error(w, "unsubscribe could not be completed", http.StatusInternalServerError)
+		return
+	}
+	if firstUse {
+		err = handler.Client.UnsubscribeUserEmail(link.Email, 0, "")
+		if err != nil {
+			log.Printf("copilot unsubscribe could not be sent: %v", err)
+			if err := handler.Replay.Forget(link.Nonce); err != nil {
+				log.Printf("copilot unsubscribe link could not be released: %v", err)
+			}
+			http.Error(w, "unsubscribe could not be completed", http.StatusBadGateway)
+			return
+		}
+	}
+	handler.DoneTemplate.Execute(w, link)
+}
@@ -0,0 +1,92 @@
+package copilot_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/GetWagz/go-copilot/copilottest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsubscribeLinks(t *testing.T) {
+	_, err := copilot.NewUnsubscribeSigner(nil, "https://example.com/unsubscribe", time.Hour)
+	assert.NotNil(t, err)
+	_, err = copilot.NewUnsubscribeSigner([]byte("key"), "/unsubscribe", time.Hour)
+	assert.NotNil(t, err)
+
+	signer, err := copilot.NewUnsubscribeSigner([]byte("key"), "https://example.com/unsubscribe?list=news", time.Hour)
+	assert.Nil(t, err)
+	link, err := signer.URL("user@example.com")
+	assert.Nil(t, err)
+	parsed, err := url.Parse(link)
+	assert.Nil(t, err)
+	assert.Equal(t, "news", parsed.Query().Get("list"))
+
+	verified, err := signer.Verify(parsed.Query())
+	assert.Nil(t, err)
+	assert.Equal(t, "user@example.com", verified.Email)
+
+	// tampering with the email breaks the signature
+	values := parsed.Query()
+	values.Set("email", "other@example.com")
+	_, err = signer.Verify(values)
+	assert.Equal(t, copilot.ErrUnsubscribeLinkInvalid, err)
+
+	// links expire
+	signer.Clock = testClock{now: time.Now().Add(2 * time.Hour)}
+	_, err = signer.Verify(parsed.Query())
+	assert.Equal(t, copilot.ErrUnsubscribeLinkExpired, err)
+
+	headers, err := signer.Headers("user@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "List-Unsubscribe=One-Click", headers["List-Unsubscribe-Post"])
+	assert.True(t, strings.HasPrefix(headers["List-Unsubscribe"], "<https://example.com/unsubscribe?"))
+}
+
+func TestUnsubscribeHandler(t *testing.T) {
+	signer, err := copilot.NewUnsubscribeSigner([]byte("key"), "https://example.com/unsubscribe", time.Hour)
+	assert.Nil(t, err)
+	recorder := copilottest.NewRecorder()
+	handler := &copilot.UnsubscribeHandler{
+		Signer: signer,
+		Client: recorder.Client,
+	}
+	link, err := signer.URL("user@example.com")
+	assert.Nil(t, err)
+
+	serve := func(method string, target string) int {
+		var body *strings.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader("List-Unsubscribe=One-Click")
+		} else {
+			body = strings.NewReader("")
+		}
+		request := httptest.NewRequest(method, target, body)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	// the confirmation page does not unsubscribe
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, link))
+	assert.Len(t, recorder.Events(), 0)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "https://example.com/unsubscribe?email=user@example.com"))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, link))
+
+	// a failure can be retried with the same link
+	recorder.FailNext(errors.New("copilot is down"))
+	assert.Equal(t, http.StatusBadGateway, serve(http.MethodPost, link))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, link))
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeUnsubscribe), 1)
+
+	// replays succeed without unsubscribing again
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, link))
+	assert.Len(t, recorder.EventsOfType(copilot.EventTypeUnsubscribe), 1)
+}
@@ -23,6 +23,11 @@ type UserEventPayload struct {
 // UserCreated tells copilot a new user was created. The userID is required.
 // All other fields can be blank and a sane default will be used.
 func UserCreated(userID string, timestamp int64, eventID string, payload *UserEventPayload) error {
+	return DefaultClient().UserCreated(userID, timestamp, eventID, payload)
+}
+
+// UserCreated is the same as the package level UserCreated, using the client's configuration
+func (client *Client) UserCreated(userID string, timestamp int64, eventID string, payload *UserEventPayload) error {
 	// basic error checking and set some defaults
 	if userID == "" {
 		return errors.New("userID cannot be blank")
@@ -31,8 +36,16 @@ func UserCreated(userID string, timestamp int64, eventID string, payload *UserEv
 	if payload == nil {
 		payload = &UserEventPayload{}
 	}
+	if err := validateUTCOffsetField(payload.UTCOffset); err != nil {
+		return err
+	}
 	payload.UserID = &userID
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeUserCreated, userID, timestamp)
 	}
@@ -43,12 +56,17 @@ func UserCreated(userID string, timestamp int64, eventID string, payload *UserEv
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // UserUpdated updates the user in copilot's system. The userID is required.
 // All other fields can be blank and a sane default will be used.
 func UserUpdated(userID string, timestamp int64, eventID string, payload *UserEventPayload) error {
+	return DefaultClient().UserUpdated(userID, timestamp, eventID, payload)
+}
+
+// UserUpdated is the same as the package level UserUpdated, using the client's configuration
+func (client *Client) UserUpdated(userID string, timestamp int64, eventID string, payload *UserEventPayload) error {
 	// basic error checking and set some defaults
 	if userID == "" {
 		return errors.New("userID cannot be blank")
@@ -57,8 +75,16 @@ func UserUpdated(userID string, timestamp int64, eventID string, payload *UserEv
 	if payload == nil {
 		payload = &UserEventPayload{}
 	}
+	if err := validateUTCOffsetField(payload.UTCOffset); err != nil {
+		return err
+	}
 	payload.UserID = &userID
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeUserUpdated, userID, timestamp)
 	}
@@ -69,11 +95,16 @@ func UserUpdated(userID string, timestamp int64, eventID string, payload *UserEv
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
 
 // UserDeleted tells copilot that a user has been deleted
 func UserDeleted(userID string, timestamp int64, eventID string) error {
+	return DefaultClient().UserDeleted(userID, timestamp, eventID)
+}
+
+// UserDeleted is the same as the package level UserDeleted, using the client's configuration
+func (client *Client) UserDeleted(userID string, timestamp int64, eventID string) error {
 	// basic error checking and set some defaults
 	if userID == "" {
 		return errors.New("userID cannot be blank")
@@ -83,6 +114,11 @@ func UserDeleted(userID string, timestamp int64, eventID string) error {
 		UserID: &userID,
 	}
 
+	timestamp, err := client.resolveTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
 	if eventID == "" {
 		eventID = eventIDHelper(EventTypeUserDeleted, userID, timestamp)
 	}
@@ -93,5 +129,5 @@ func UserDeleted(userID string, timestamp int64, eventID string) error {
 		Timestamp: timestamp,
 		Payload:   payload,
 	}
-	return event.sendEvent()
+	return client.sendEvent(&event)
 }
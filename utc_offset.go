@@ -0,0 +1,200 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// utcOffsetPattern matches the offsets Copilot expects, such as -0500 or +0530
+var utcOffsetPattern = regexp.MustCompile(`^[+-][0-9]{4}$`)
+
+// UTCOffset formats the offset of the location at the provided instant, such as -0500 or +0530. Since offsets
+// change with daylight saving time, the instant matters. A zero instant uses the current time.
+func UTCOffset(loc *time.Location, at time.Time) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	if at.IsZero() {
+		at = now()
+	}
+	return at.In(loc).Format("-0700")
+}
+
+// UTCOffsetForZone formats the offset of an IANA time zone, such as America/New_York, at the provided instant
+func UTCOffsetForZone(zone string, at time.Time) (string, error) {
+	if zone == "" {
+		return "", errors.New("zone cannot be blank")
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	return UTCOffset(loc, at), nil
+}
+
+// ValidateUTCOffset checks that the offset is in the format Copilot expects, a sign followed by
+// hours and minutes, such as -0500
+func ValidateUTCOffset(offset string) error {
+	if !utcOffsetPattern.MatchString(offset) {
+		return fmt.Errorf("utc offset %s must be formatted like -0500", offset)
+	}
+	hours, _ := strconv.Atoi(offset[1:3])
+	minutes, _ := strconv.Atoi(offset[3:5])
+	if hours > 14 || minutes > 59 {
+		return fmt.Errorf("utc offset %s is out of range", offset)
+	}
+	return nil
+}
+
+// validateUTCOffsetField validates an optional offset on a payload
+func validateUTCOffsetField(offset *string) error {
+	if offset == nil {
+		return nil
+	}
+	return ValidateUTCOffset(*offset)
+}
+
+// UTCOffsetTracker keeps track of the time zone of each user and calls UserUpdated with the new offset
+// whenever a user's offset changes, such as at a daylight saving time boundary
+type UTCOffsetTracker struct {
+	// OnError is called with any errors from the background checks. It defaults to logging the error.
+	OnError func(error)
+	// Client sends the events; if nil, the default client is used
+	Client *Client
+
+	lock  sync.Mutex
+	users map[string]*trackedUTCOffset
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// trackedUTCOffset is the time zone and last sent offset for a user
+type trackedUTCOffset struct {
+	loc    *time.Location
+	offset string
+}
+
+// NewUTCOffsetTracker creates a new, empty tracker
+func NewUTCOffsetTracker() *UTCOffsetTracker {
+	return &UTCOffsetTracker{
+		users: map[string]*trackedUTCOffset{},
+	}
+}
+
+// Track sets the IANA time zone of the user. The current offset is recorded without sending an event, as it is
+// expected to have been sent with UserCreated or UserUpdated; it is returned so it can be used for that call.
+func (tracker *UTCOffsetTracker) Track(userID, zone string) (string, error) {
+	if userID == "" {
+		return "", errors.New("userID cannot be blank")
+	}
+	if zone == "" {
+		return "", errors.New("zone cannot be blank")
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	offset := UTCOffset(loc, tracker.Client.now())
+
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	tracker.users[userID] = &trackedUTCOffset{
+		loc:    loc,
+		offset: offset,
+	}
+	return offset, nil
+}
+
+// Untrack stops tracking the user
+func (tracker *UTCOffsetTracker) Untrack(userID string) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	delete(tracker.users, userID)
+}
+
+// Check calls UserUpdated for every tracked user whose offset at the instant differs from the last offset sent.
+// A zero instant uses the current time. The first error encountered is returned; users that failed are
+// retried on the next check.
+func (tracker *UTCOffsetTracker) Check(at time.Time) error {
+	if at.IsZero() {
+		at = tracker.Client.now()
+	}
+	changed := map[string]string{}
+	tracker.lock.Lock()
+	for userID, tracked := range tracker.users {
+		offset := UTCOffset(tracked.loc, at)
+		if offset != tracked.offset {
+			changed[userID] = offset
+		}
+	}
+	tracker.lock.Unlock()
+
+	var firstErr error
+	for userID, offset := range changed {
+		err := tracker.Client.UserUpdated(userID, Timestamp(at), "", &UserEventPayload{
+			UTCOffset: String(offset),
+		})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		tracker.lock.Lock()
+		if tracked, found := tracker.users[userID]; found {
+			tracked.offset = offset
+		}
+		tracker.lock.Unlock()
+	}
+	return firstErr
+}
+
+// Start calls Check on the interval in the background until Stop is called
+func (tracker *UTCOffsetTracker) Start(interval time.Duration) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if tracker.done != nil || interval <= 0 {
+		return
+	}
+	if tracker.OnError == nil {
+		tracker.OnError = func(err error) {
+			log.Printf("copilot utc offset change could not be sent: %v", err)
+		}
+	}
+	done := make(chan struct{})
+	tracker.done = done
+	tracker.wg.Add(1)
+	go func() {
+		defer tracker.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := tracker.Check(time.Time{}); err != nil {
+					tracker.OnError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the background checks started with Start
+func (tracker *UTCOffsetTracker) Stop() {
+	tracker.lock.Lock()
+	done := tracker.done
+	tracker.done = nil
+	tracker.lock.Unlock()
+	if done != nil {
+		close(done)
+		tracker.wg.Wait()
+	}
+}
@@ -0,0 +1,69 @@
+package copilot_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/GetWagz/go-copilot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUTCOffsets(t *testing.T) {
+	userID := fmt.Sprintf("test---%d", rand.Int63n(9999999))
+	timestamp := time.Now().UnixMilli()
+	winter := time.Date(2022, time.January, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2022, time.July, 15, 12, 0, 0, 0, time.UTC)
+
+	offset, err := copilot.UTCOffsetForZone("America/New_York", winter)
+	assert.Nil(t, err)
+	assert.Equal(t, "-0500", offset)
+	offset, err = copilot.UTCOffsetForZone("America/New_York", summer)
+	assert.Nil(t, err)
+	assert.Equal(t, "-0400", offset)
+	offset, err = copilot.UTCOffsetForZone("Asia/Kolkata", summer)
+	assert.Nil(t, err)
+	assert.Equal(t, "+0530", offset)
+	_, err = copilot.UTCOffsetForZone("Not/AZone", summer)
+	assert.NotNil(t, err)
+	assert.Equal(t, "+0000", copilot.UTCOffset(nil, summer))
+
+	assert.Nil(t, copilot.ValidateUTCOffset("-0500"))
+	assert.Nil(t, copilot.ValidateUTCOffset("+1245"))
+	for _, invalid := range []string{"", "-5", "-05:00", "0500", "EST", "+1500", "-0560"} {
+		assert.NotNil(t, copilot.ValidateUTCOffset(invalid), invalid)
+	}
+
+	// malformed offsets are rejected before anything is sent
+	err = copilot.UserCreated(userID, timestamp, "", &copilot.UserEventPayload{
+		UTCOffset: copilot.String("-5:00"),
+	})
+	assert.NotNil(t, err)
+	err = copilot.PreexistingUserCreated(userID, timestamp, "", &copilot.PreexistingUserEventPayload{
+		UTCOffset: copilot.String("EST"),
+	})
+	assert.NotNil(t, err)
+
+	tracker := copilot.NewUTCOffsetTracker()
+	_, err = tracker.Track("", "America/New_York")
+	assert.NotNil(t, err)
+	_, err = tracker.Track(userID, "Not/AZone")
+	assert.NotNil(t, err)
+	_, err = tracker.Track(userID, "UTC")
+	assert.Nil(t, err)
+	// the offset has not changed, so nothing is sent
+	err = tracker.Check(time.Time{})
+	assert.Nil(t, err)
+
+	if !copilot.IsSetUp() {
+		t.SkipNow()
+	}
+
+	_, err = tracker.Track(userID, "America/New_York")
+	assert.Nil(t, err)
+	err = tracker.Check(winter)
+	assert.Nil(t, err)
+	err = tracker.Check(summer)
+	assert.Nil(t, err)
+}